@@ -0,0 +1,228 @@
+package cast
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// artNames are the base names of the image files used as the cover art of their directories in the order of preference.
+var artNames = []string{"cover", "folder", "poster"}
+
+// artTypes are the extensions of the cover art files by their MIME types.
+var artTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// picture is the location of an image embedded in a media file.
+type picture struct {
+	Offset int64
+	Size   int64
+	MIME   string
+	// Width and Height are the size of the picture, or zero if it can't be decoded.
+	Width  int
+	Height int
+	// Front tells if it's the front cover.
+	Front bool
+}
+
+// frontCover is the picture type of the front cover in ID3 attached picture frames and FLAC picture blocks.
+const frontCover = 3
+
+// prefer tells if a picture of the type should replace the current one, i.e. it's the first one or the first front cover.
+func (p *picture) prefer(typ uint32) bool {
+	return p.Size == 0 || typ == frontCover && !p.Front
+}
+
+// imageType returns the MIME type of a JPEG or PNG image told by its first bytes, or "" for other images.
+func imageType(b []byte) string {
+	switch {
+	case strings.HasPrefix(string(b), "\xff\xd8\xff"):
+		return "image/jpeg"
+	case strings.HasPrefix(string(b), "\x89PNG\r\n\x1a\n"):
+		return "image/png"
+	default:
+		return ""
+	}
+}
+
+// Art is the cover art of a container or an item, which is either an image file such as folder.jpg or a picture embedded in an audio file.
+// It's also a resized copy of an image.
+type Art struct {
+	ID   string
+	MIME string
+	URL  *url.URL
+	// Width and Height are the size of the image as it's served.
+	Width  int
+	Height int
+
+	path string
+	// offset and size locate the embedded picture in the file. size is zero for image files.
+	offset int64
+	size   int64
+	// profile is the DLNA media format profile of the resized copy, or empty if it's served as is.
+	profile     string
+	orientation int
+}
+
+// ProfileID returns the DLNA media format profile of the art.
+func (a *Art) ProfileID() string {
+	if a.profile != "" {
+		return a.profile
+	}
+	if a.MIME == "image/png" {
+		return "PNG_TN"
+	}
+	return "JPEG_TN"
+}
+
+// ProtocolInfo returns the protocol info of the art as a resource.
+func (a *Art) ProtocolInfo() string {
+	return protocolInfo(a.MIME, a.ProfileID(), a.profile != "", dlnaOpRange)
+}
+
+// thumbnailArt returns the art a of a w x h image in JPEG_TN or PNG_TN.
+// It's served as is if it fits in them and is upright, or resized into JPEG_TN otherwise.
+// Nil is returned if the size of the image is unknown.
+func thumbnailArt(base *url.URL, a Art, w, h int) *Art {
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	if a.orientation >= 5 {
+		w, h = h, w
+	}
+	tn := imageProfiles[0]
+	if w <= tn.width && h <= tn.height && a.orientation < 2 {
+		a.Width, a.Height = w, h
+	} else {
+		a.MIME = "image/jpeg"
+		a.profile = tn.name
+		a.Width, a.Height = fit(w, h, tn.width, tn.height)
+	}
+	a.URL = base.ResolveReference(&url.URL{Path: a.ID + artTypes[a.MIME]})
+	return &a
+}
+
+// covers returns the cover art files among the paths by their directories.
+// Nothing is returned if m.ArtURL is nil.
+// It must be called with m.mu locked.
+func (m *MediaLibrary) covers(paths []string) map[string]*Art {
+	covers := map[string]*Art{}
+	if m.ArtURL == nil {
+		return covers
+	}
+
+	rank := map[string]int{}
+	for _, p := range paths {
+		e := m.entries[p]
+		if _, ok := artTypes[e.MIME]; !ok || e.Dir {
+			continue
+		}
+		base := strings.ToLower(filepath.Base(p))
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+		n := -1
+		for i, name := range artNames {
+			if base == name {
+				n = i
+			}
+		}
+		dir := filepath.Dir(p)
+		if r, ok := rank[dir]; n < 0 || ok && r <= n {
+			continue
+		}
+		r, ok := m.root(p)
+		if !ok {
+			continue
+		}
+		rel, _ := r.rel(p)
+		a := thumbnailArt(m.ArtURL, Art{
+			ID:          r.id(rel),
+			MIME:        e.MIME,
+			path:        p,
+			orientation: e.Meta.Orientation,
+		}, e.Meta.Width, e.Meta.Height)
+		if a == nil {
+			continue
+		}
+		rank[dir] = n
+		covers[dir] = a
+	}
+	return covers
+}
+
+// embeddedArt returns the picture embedded in the file of the item i, if any.
+func (m *MediaLibrary) embeddedArt(i MediaItem, e *entry) *Art {
+	pic := e.Meta.Picture
+	if _, ok := artTypes[pic.MIME]; m.ArtURL == nil || !ok || pic.Size == 0 {
+		return nil
+	}
+	return thumbnailArt(m.ArtURL, Art{
+		ID:     i.ID,
+		MIME:   pic.MIME,
+		path:   i.path,
+		offset: pic.Offset,
+		size:   pic.Size,
+	}, pic.Width, pic.Height)
+}
+
+// firstArt returns the art of the first item which has any.
+func firstArt(items MediaItems) *Art {
+	for _, i := range items {
+		if i.AlbumArt != nil {
+			return i.AlbumArt
+		}
+	}
+	return nil
+}
+
+// Art serves the cover art and the resized copies of images at /{id}{ext} where ext is .jpg or .png, with the DLNA headers as Media does.
+func (m *MediaLibrary) Art(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	id := strings.TrimSuffix(name, path.Ext(name))
+
+	m.mu.RLock()
+	a, ok := m.art[id]
+	m.mu.RUnlock()
+	if !ok || path.Base(a.URL.Path) != name {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		log.WithField("path", a.path).WithError(err).Warn("Failed to open.")
+		http.NotFound(w, r)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	if !dlnaHeaders(w, r, a.ProtocolInfo()) {
+		return
+	}
+	size := a.size
+	if size == 0 {
+		size = fi.Size()
+	}
+	src := io.NewSectionReader(f, a.offset, size)
+	if a.profile != "" {
+		m.serveThumbnail(w, r, a, src, name, fi.ModTime())
+		return
+	}
+
+	w.Header().Set("Content-Type", a.MIME)
+	http.ServeContent(w, r, name, fi.ModTime(), src)
+}
@@ -0,0 +1,212 @@
+package cast
+
+import (
+	"bytes"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThumbnailArt(t *testing.T) {
+	base := &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/art/"}
+	tests := []struct {
+		name          string
+		mime          string
+		width, height int
+		orientation   int
+		want          *Art
+		protocolInfo  string
+	}{
+		{
+			name: "small JPEG", mime: "image/jpeg", width: 160, height: 120,
+			want:         &Art{MIME: "image/jpeg", Width: 160, Height: 120},
+			protocolInfo: "http-get:*:image/jpeg:DLNA.ORG_PN=JPEG_TN;DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=00D00000000000000000000000000000",
+		},
+		{
+			name: "small PNG", mime: "image/png", width: 100, height: 100,
+			want:         &Art{MIME: "image/png", Width: 100, Height: 100},
+			protocolInfo: "http-get:*:image/png:DLNA.ORG_PN=PNG_TN;DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=00D00000000000000000000000000000",
+		},
+		{
+			name: "large JPEG", mime: "image/jpeg", width: 1000, height: 500,
+			want:         &Art{MIME: "image/jpeg", Width: 160, Height: 80, profile: "JPEG_TN"},
+			protocolInfo: "http-get:*:image/jpeg:DLNA.ORG_PN=JPEG_TN;DLNA.ORG_OP=01;DLNA.ORG_CI=1;DLNA.ORG_FLAGS=00D00000000000000000000000000000",
+		},
+		{
+			name: "large PNG", mime: "image/png", width: 500, height: 500,
+			want:         &Art{MIME: "image/jpeg", Width: 160, Height: 160, profile: "JPEG_TN"},
+			protocolInfo: "http-get:*:image/jpeg:DLNA.ORG_PN=JPEG_TN;DLNA.ORG_OP=01;DLNA.ORG_CI=1;DLNA.ORG_FLAGS=00D00000000000000000000000000000",
+		},
+		{
+			name: "turned", mime: "image/jpeg", width: 32, height: 16, orientation: 6,
+			want:         &Art{MIME: "image/jpeg", Width: 16, Height: 32, profile: "JPEG_TN", orientation: 6},
+			protocolInfo: "http-get:*:image/jpeg:DLNA.ORG_PN=JPEG_TN;DLNA.ORG_OP=01;DLNA.ORG_CI=1;DLNA.ORG_FLAGS=00D00000000000000000000000000000",
+		},
+		{name: "unknown size", mime: "image/jpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := thumbnailArt(base, Art{ID: "1", MIME: tt.mime, orientation: tt.orientation}, tt.width, tt.height)
+			if tt.want == nil {
+				if a != nil {
+					t.Errorf("got %+v, want nil", a)
+				}
+				return
+			}
+			if a == nil {
+				t.Fatal("got nil")
+			}
+			if a.MIME != tt.want.MIME || a.Width != tt.want.Width || a.Height != tt.want.Height || a.profile != tt.want.profile || a.orientation != tt.want.orientation {
+				t.Errorf("got %+v, want %+v", a, tt.want)
+			}
+			if want := "http://192.0.2.1:8200/art/1" + artTypes[tt.want.MIME]; a.URL.String() != want {
+				t.Errorf("got %s, want %s", a.URL, want)
+			}
+			if got := a.ProtocolInfo(); got != tt.protocolInfo {
+				t.Errorf("got %s, want %s", got, tt.protocolInfo)
+			}
+		})
+	}
+}
+
+func TestMediaLibrary_Art(t *testing.T) {
+	b, err := os.ReadFile("testdata/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The picture is embedded in the middle of a file as in an audio file.
+	path := t.TempDir() + "/a.mp3"
+	if err := os.WriteFile(path, append(append([]byte("ID3"), b...), "tail"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/art/"}
+	tests := []struct {
+		name          string
+		orientation   int
+		width, height int
+		resized       bool
+	}{
+		{name: "as is", width: 32, height: 16},
+		{name: "resized", orientation: 6, width: 16, height: 32, resized: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := thumbnailArt(base, Art{ID: "1", MIME: "image/jpeg", path: path, offset: 3, size: int64(len(b)), orientation: tt.orientation}, 32, 16)
+			m := MediaLibrary{art: map[string]*Art{a.ID: a}}
+
+			r := httptest.NewRequest(http.MethodGet, "/1.jpg", nil)
+			r.Header.Set("getcontentFeatures.dlna.org", "1")
+			w := httptest.NewRecorder()
+			m.Art(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got %d", w.Code)
+			}
+			if got := w.Header()["contentFeatures.dlna.org"]; len(got) != 1 || "http-get:*:image/jpeg:"+got[0] != a.ProtocolInfo() {
+				t.Errorf("got contentFeatures.dlna.org %q", got)
+			}
+			if !tt.resized && !bytes.Equal(w.Body.Bytes(), b) {
+				t.Error("not served as is")
+			}
+			c, err := jpeg.DecodeConfig(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Width != tt.width || c.Height != tt.height {
+				t.Errorf("got %dx%d, want %dx%d", c.Width, c.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestMediaLibrary_ThumbnailDir(t *testing.T) {
+	b, err := os.ReadFile("testdata/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, cache := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The copy of a removed image and a file which isn't a copy.
+	for _, name := range []string{"0123456789abcdef.jpg", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(cache, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := MediaLibrary{
+		BaseURL:      &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"},
+		ArtURL:       &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/art/"},
+		ThumbnailDir: cache,
+		Roots:        []Root{{Path: dir}},
+	}
+	thumbnail := func() string {
+		t.Helper()
+		i := m.objects[m.Roots[0].id("a.jpg")]
+		if i == nil || len(i.Variants) == 0 {
+			t.Fatalf("got %+v", i)
+		}
+		w := httptest.NewRecorder()
+		m.Art(w, httptest.NewRequest(http.MethodGet, "/"+i.Variants[0].ID+".jpg", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d", w.Code)
+		}
+		return thumbnailCache(i.Variants[0], m.entries[path].ModTime)
+	}
+	// wait waits for the files in the cache to be the names.
+	wait := func(names ...string) {
+		t.Helper()
+		sort.Strings(names)
+		var got []string
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			files, err := os.ReadDir(cache)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = got[:0]
+			for _, f := range files {
+				got = append(got, f.Name())
+			}
+			if strings.Join(got, ",") == strings.Join(names, ",") {
+				return
+			}
+		}
+		t.Fatalf("got %q, want %q", got, names)
+	}
+
+	if err := m.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	wait("notes.txt")
+	old := thumbnail()
+	wait(old, "notes.txt")
+
+	// The copy of the modified image is replaced.
+	modTime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	wait("notes.txt")
+	wait(thumbnail(), "notes.txt")
+
+	// The copy of the removed image is removed.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	wait("notes.txt")
+}
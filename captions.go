@@ -0,0 +1,334 @@
+package cast
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/saintfish/chardet"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// decodeText converts text in an unknown character encoding into UTF-8.
+// The encoding is told by the byte order mark if any and otherwise guessed from the content.
+func decodeText(b []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(b, []byte("\xef\xbb\xbf")), bytes.HasPrefix(b, []byte("\xff\xfe")), bytes.HasPrefix(b, []byte("\xfe\xff")):
+		s, _, err := transform.Bytes(unicode.BOMOverride(encoding.Nop.NewDecoder()), b)
+		return string(s), err
+	}
+	if utf8.Valid(b) {
+		return string(b), nil
+	}
+
+	r, err := chardet.NewTextDetector().DetectBest(b)
+	if err != nil {
+		return "", err
+	}
+	enc, err := htmlindex.Get(r.Charset)
+	if err != nil {
+		if enc, err = ianaindex.IANA.Encoding(strings.ReplaceAll(r.Charset, "-", "")); err != nil || enc == nil {
+			return "", fmt.Errorf("unsupported charset: %s", r.Charset)
+		}
+	}
+	s, err := enc.NewDecoder().Bytes(b)
+	return string(s), err
+}
+
+// cue is a piece of subtitle text shown from start to end.
+type cue struct {
+	start, end time.Duration
+	// text is lines of plain text with optional <i>, <b> and <u> tags.
+	text string
+}
+
+// parseCaptions reads the cues of a subtitle of the type, i.e. srt, vtt, ass, ssa or smi.
+func parseCaptions(typ, s string) ([]cue, error) {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+	switch typ {
+	case "srt", "vtt":
+		return parseCueBlocks(s), nil
+	case "ass", "ssa":
+		return parseASS(s), nil
+	case "smi":
+		return parseSMI(s), nil
+	default:
+		return nil, fmt.Errorf("unknown subtitle type: %s", typ)
+	}
+}
+
+// parseCueBlocks reads SRT and WebVTT, both of which consist of blocks of an optional identifier, timings and text.
+func parseCueBlocks(s string) []cue {
+	var cues []cue
+	for _, block := range strings.Split(s, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		for i, l := range lines {
+			start, end, ok := parseTimings(l)
+			if !ok {
+				continue
+			}
+			if text := cleanCaption(strings.Join(lines[i+1:], "\n")); text != "" {
+				cues = append(cues, cue{start: start, end: end, text: text})
+			}
+			break
+		}
+	}
+	return cues
+}
+
+// parseTimings parses a line of timings, e.g. "00:01:02,345 --> 00:01:03,456" and "01:02.345 --> 01:03.456 align:start".
+func parseTimings(line string) (time.Duration, time.Duration, bool) {
+	i := strings.Index(line, "-->")
+	if i < 0 {
+		return 0, 0, false
+	}
+	end := strings.Fields(line[i+3:])
+	if len(end) == 0 {
+		return 0, 0, false
+	}
+	s, ok1 := parseTimestamp(strings.TrimSpace(line[:i]))
+	e, ok2 := parseTimestamp(end[0])
+	return s, e, ok1 && ok2
+}
+
+// parseTimestamp parses a timestamp in the form of [HH:]MM:SS[.,]FFF. The fraction may have any number of digits.
+func parseTimestamp(s string) (time.Duration, bool) {
+	var frac time.Duration
+	if i := strings.LastIndexAny(s, ".,"); i >= 0 {
+		f := s[i+1:]
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return 0, false
+		}
+		frac = time.Duration(n) * time.Second
+		for range f {
+			frac /= 10
+		}
+		s = s[:i]
+	}
+	var d time.Duration
+	for _, p := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return 0, false
+		}
+		d = d*60 + time.Duration(n)*time.Second
+	}
+	return d + frac, true
+}
+
+// parseASS reads the dialogues of Advanced SubStation Alpha and SubStation Alpha.
+func parseASS(s string) []cue {
+	var (
+		cues   []cue
+		events bool
+		format = []string{"layer", "start", "end", "style", "name", "marginl", "marginr", "marginv", "effect", "text"}
+	)
+	sc := bufio.NewScanner(strings.NewReader(s))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") {
+			events = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !events {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		switch key, value := strings.ToLower(line[:i]), line[i+1:]; key {
+		case "format":
+			format = format[:0]
+			for _, f := range strings.Split(value, ",") {
+				format = append(format, strings.ToLower(strings.TrimSpace(f)))
+			}
+		case "dialogue":
+			fields := strings.SplitN(value, ",", len(format))
+			if len(fields) < len(format) {
+				continue
+			}
+			var c cue
+			for i, f := range format {
+				switch f {
+				case "start":
+					c.start, _ = parseTimestamp(strings.TrimSpace(fields[i]))
+				case "end":
+					c.end, _ = parseTimestamp(strings.TrimSpace(fields[i]))
+				case "text":
+					c.text = assText(fields[i])
+				}
+			}
+			if c.text != "" {
+				cues = append(cues, c)
+			}
+		}
+	}
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].start < cues[j].start
+	})
+	return cues
+}
+
+var assOverride = regexp.MustCompile(`\{[^}]*\}`)
+
+// assText converts the text of a dialogue into plain text by removing override codes.
+func assText(s string) string {
+	var italic, bold, underline bool
+	s = assOverride.ReplaceAllStringFunc(s, func(o string) string {
+		var tags string
+		for _, code := range strings.Split(strings.Trim(o, "{}"), `\`) {
+			switch code {
+			case "i1":
+				italic, tags = true, tags+"<i>"
+			case "i0":
+				if italic {
+					italic, tags = false, tags+"</i>"
+				}
+			case "b1":
+				bold, tags = true, tags+"<b>"
+			case "b0":
+				if bold {
+					bold, tags = false, tags+"</b>"
+				}
+			case "u1":
+				underline, tags = true, tags+"<u>"
+			case "u0":
+				if underline {
+					underline, tags = false, tags+"</u>"
+				}
+			}
+		}
+		return tags
+	})
+	if underline {
+		s += "</u>"
+	}
+	if bold {
+		s += "</b>"
+	}
+	if italic {
+		s += "</i>"
+	}
+	s = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(s)
+	return cleanCaption(s)
+}
+
+var (
+	smiSync  = regexp.MustCompile(`(?i)<sync[^>]*\sstart\s*=\s*["']?(\d+)[^>]*>`)
+	smiBreak = regexp.MustCompile(`(?i)<br\s*/?>`)
+)
+
+// parseSMI reads Synchronized Accessible Media Interchange. Each cue lasts until the next synchronization point.
+func parseSMI(s string) []cue {
+	ms := smiSync.FindAllStringSubmatchIndex(s, -1)
+	var cues []cue
+	for i, m := range ms {
+		start, _ := strconv.Atoi(s[m[2]:m[3]])
+		end := start + 5000
+		body := s[m[1]:]
+		if i+1 < len(ms) {
+			end, _ = strconv.Atoi(s[ms[i+1][2]:ms[i+1][3]])
+			body = s[m[1]:ms[i+1][0]]
+		}
+		// Line breaks are <br> as in HTML.
+		body = smiBreak.ReplaceAllString(strings.ReplaceAll(body, "\n", " "), "\n")
+		if text := cleanCaption(body); text != "" {
+			cues = append(cues, cue{
+				start: time.Duration(start) * time.Millisecond,
+				end:   time.Duration(end) * time.Millisecond,
+				text:  text,
+			})
+		}
+	}
+	return cues
+}
+
+var (
+	captionTag    = regexp.MustCompile(`</?([a-zA-Z][a-zA-Z0-9.]*)[^>]*>`)
+	captionBlanks = regexp.MustCompile(`[ \t\p{Zs}]+`)
+)
+
+// cleanCaption removes markups other than <i>, <b> and <u>, decodes character references and trims spaces in lines.
+func cleanCaption(s string) string {
+	s = captionTag.ReplaceAllStringFunc(s, func(t string) string {
+		name := strings.ToLower(captionTag.FindStringSubmatch(t)[1])
+		switch name {
+		case "i", "b", "u":
+			if strings.HasPrefix(t, "</") {
+				return "</" + name + ">"
+			}
+			return "<" + name + ">"
+		default:
+			return ""
+		}
+	})
+	s = html.UnescapeString(s)
+
+	var lines []string
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.TrimSpace(captionBlanks.ReplaceAllString(l, " ")); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeSRT writes the cues in SubRip.
+func writeSRT(cues []cue) []byte {
+	var b bytes.Buffer
+	for i, c := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, captionTime(c.start, ','), captionTime(c.end, ','), c.text)
+	}
+	return b.Bytes()
+}
+
+// writeVTT writes the cues in WebVTT.
+func writeVTT(cues []cue) []byte {
+	var b bytes.Buffer
+	b.WriteString("WEBVTT\n\n")
+	for _, c := range cues {
+		// Blank lines would end the cue.
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", captionTime(c.start, '.'), captionTime(c.end, '.'), escapeVTT(c.text))
+	}
+	return b.Bytes()
+}
+
+var (
+	vttTag     = regexp.MustCompile(`</?[ibu]>`)
+	vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// escapeVTT escapes the text of a cue as WebVTT requires, except for the <i>, <b> and <u> tags kept by cleanCaption.
+func escapeVTT(s string) string {
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, loc := range vttTag.FindAllStringIndex(s, -1) {
+		b.WriteString(vttEscaper.Replace(s[last:loc[0]]))
+		b.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(vttEscaper.Replace(s[last:]))
+	return b.String()
+}
+
+// captionTime formats d in the form of HH:MM:SS followed by sep and milliseconds.
+func captionTime(d time.Duration, sep byte) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,202 @@
+package cast
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestDecodeText(t *testing.T) {
+	sjis, err := japanese.ShiftJIS.NewEncoder().String(strings.Repeat("今日は良い天気ですね。明日も晴れるでしょう。\n", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp1252, err := charmap.Windows1252.NewEncoder().String(strings.Repeat("Voilà, c'était l'été à côté de la forêt. ", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf16, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String("1\n00:00:01,000 --> 00:00:02,000\nこんにちは\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "UTF-8", data: "Voilà", want: "Voilà"},
+		{name: "UTF-8 with BOM", data: "\xef\xbb\xbfVoilà", want: "Voilà"},
+		{name: "UTF-16 with BOM", data: utf16, want: "1\n00:00:01,000 --> 00:00:02,000\nこんにちは\n"},
+		{name: "Shift_JIS", data: sjis, want: strings.Repeat("今日は良い天気ですね。明日も晴れるでしょう。\n", 10)},
+		{name: "Windows-1252", data: cp1252, want: strings.Repeat("Voilà, c'était l'été à côté de la forêt. ", 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeText([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCaptions(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  string
+		s    string
+		want []cue
+	}{
+		{
+			name: "SubRip",
+			typ:  "srt",
+			s:    "1\r\n00:00:01,000 --> 00:00:02,500\r\n<font color=\"red\">Hello</font>\r\n<i>world</i>\r\n\r\n2\r\n00:01:00,000 --> 00:01:01,000\r\nFish &amp; chips\r\n\r\n3\r\n00:02:00,000 --> 00:02:01,000\r\n\r\n",
+			want: []cue{
+				{start: time.Second, end: 2500 * time.Millisecond, text: "Hello\n<i>world</i>"},
+				{start: time.Minute, end: time.Minute + time.Second, text: "Fish & chips"},
+			},
+		},
+		{
+			name: "WebVTT",
+			typ:  "vtt",
+			s:    "WEBVTT\n\nNOTE a comment\n\nintro\n01:02.5 --> 01:03.25 align:start\n<v Roger>Hi</v>\n<c.yellow>there</c>\n",
+			want: []cue{
+				{start: time.Minute + 2500*time.Millisecond, end: time.Minute + 3250*time.Millisecond, text: "Hi\nthere"},
+			},
+		},
+		{
+			name: "ASS",
+			typ:  "ass",
+			s: "[Script Info]\nTitle: a\n\n[V4+ Styles]\nFormat: Name, Fontname\nStyle: Default,Arial\n\n[Events]\n" +
+				"Format: Layer, Start, End, Style, Text\n" +
+				"Dialogue: 0,0:00:05.00,0:00:06.00,Default,Later\n" +
+				"Dialogue: 0,0:00:01.50,0:00:02.00,Default,{\\an8\\i1}Hello,{\\i0} world\\Nagain\n" +
+				"Dialogue: 0,0:00:03.00,0:00:04.00,Default,{\\b1}bold\n" +
+				"Comment: 0,0:00:03.00,0:00:04.00,Default,comment\n",
+			want: []cue{
+				{start: 1500 * time.Millisecond, end: 2 * time.Second, text: "<i>Hello,</i> world\nagain"},
+				{start: 3 * time.Second, end: 4 * time.Second, text: "<b>bold</b>"},
+				{start: 5 * time.Second, end: 6 * time.Second, text: "Later"},
+			},
+		},
+		{
+			name: "SMI",
+			typ:  "smi",
+			s: "<SAMI><BODY>\n<SYNC Start=1000><P Class=KRCC>Hello<br>world\n" +
+				"<SYNC Start=2000><P Class=KRCC>&nbsp;\n" +
+				"<SYNC Start=3000><P Class=KRCC>Bye\n</BODY></SAMI>",
+			want: []cue{
+				{start: time.Second, end: 2 * time.Second, text: "Hello\nworld"},
+				{start: 3 * time.Second, end: 8 * time.Second, text: "Bye"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCaptions(tt.typ, tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %+v, want %+v", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := parseCaptions("sub", ""); err == nil {
+		t.Error("unknown type parsed")
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{s: "00:01:02,345", want: time.Minute + 2345*time.Millisecond, ok: true},
+		{s: "01:02.345", want: time.Minute + 2345*time.Millisecond, ok: true},
+		{s: "1:02:03.4", want: time.Hour + 2*time.Minute + 3400*time.Millisecond, ok: true},
+		{s: "0:00:01.25", want: 1250 * time.Millisecond, ok: true},
+		{s: "00:00:05", want: 5 * time.Second, ok: true},
+		{s: "00:xx:05", ok: false},
+		{s: "00:00:05.x", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, ok := parseTimestamp(tt.s)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got %s %t, want %s %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCleanCaption(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{name: "kept tags", s: "<I>a</I> <b class=x>b</b> <u>c</u>", want: "<i>a</i> <b>b</b> <u>c</u>"},
+		{name: "other tags", s: `<font color="#fff">a</font><ruby>b<rt>c</rt></ruby>`, want: "abc"},
+		{name: "character references", s: "a &lt;b&gt; &amp; c&#39;s", want: "a <b> & c's"},
+		{name: "blanks", s: "  a \t b　c  \n\n \n d ", want: "a b c\nd"},
+		{name: "not a tag", s: "1 < 2 > 0", want: "1 < 2 > 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanCaption(tt.s); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCaptions(t *testing.T) {
+	cues := []cue{
+		{start: time.Second, end: 2500 * time.Millisecond, text: "<i>Hello</i>\nworld"},
+		{start: time.Hour + time.Minute, end: time.Hour + time.Minute + 1001*time.Millisecond, text: "Fish & chips <b>1 < 2</b> -->"},
+	}
+	if got, want := string(writeSRT(cues)), "1\n00:00:01,000 --> 00:00:02,500\n<i>Hello</i>\nworld\n\n"+
+		"2\n01:01:00,000 --> 01:01:01,001\nFish & chips <b>1 < 2</b> -->\n\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Text other than the tags is escaped in WebVTT.
+	if got, want := string(writeVTT(cues)), "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\n<i>Hello</i>\nworld\n\n"+
+		"01:01:00.000 --> 01:01:01.001\nFish &amp; chips <b>1 &lt; 2</b> --&gt;\n\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEscapeVTT(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "plain", want: "plain"},
+		{s: "<i>a & b</i>", want: "<i>a &amp; b</i>"},
+		{s: "<b><u>x</u></b>", want: "<b><u>x</u></b>"},
+		{s: "<c.red>x</c>", want: "&lt;c.red&gt;x&lt;/c&gt;"},
+		{s: "&amp;", want: "&amp;amp;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := escapeVTT(tt.s); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package cast
+
+import (
+	"strings"
+)
+
+// MediaClass is a class of the ContentDirectory objects.
+type MediaClass int
+
+const (
+	MediaClassStorageFolder MediaClass = iota
+	MediaClassItem
+	MediaClassImageItem
+	MediaClassAudioItem
+	MediaClassVideoItem
+	MediaClassMusicTrack
+	MediaClassPhoto
+	MediaClassContainer
+	MediaClassMusicArtist
+	MediaClassMusicAlbum
+	MediaClassMusicGenre
+	MediaClassPhotoAlbum
+	MediaClassPlaylistContainer
+	MediaClassAudioBroadcast
+	MediaClassAudioBook
+	MediaClassMovie
+	MediaClassVideoBroadcast
+	MediaClassMusicVideoClip
+	MediaClassPlaylistItem
+	MediaClassTextItem
+	MediaClassPerson
+	MediaClassAlbum
+	MediaClassGenre
+	MediaClassMovieGenre
+	MediaClassStorageSystem
+	MediaClassStorageVolume
+)
+
+func (c MediaClass) String() string {
+	return [...]string{
+		MediaClassStorageFolder:     "object.container.storageFolder",
+		MediaClassItem:              "object.item",
+		MediaClassImageItem:         "object.item.imageItem",
+		MediaClassAudioItem:         "object.item.audioItem",
+		MediaClassVideoItem:         "object.item.videoItem",
+		MediaClassMusicTrack:        "object.item.audioItem.musicTrack",
+		MediaClassPhoto:             "object.item.imageItem.photo",
+		MediaClassContainer:         "object.container",
+		MediaClassMusicArtist:       "object.container.person.musicArtist",
+		MediaClassMusicAlbum:        "object.container.album.musicAlbum",
+		MediaClassMusicGenre:        "object.container.genre.musicGenre",
+		MediaClassPhotoAlbum:        "object.container.album.photoAlbum",
+		MediaClassPlaylistContainer: "object.container.playlistContainer",
+		MediaClassAudioBroadcast:    "object.item.audioItem.audioBroadcast",
+		MediaClassAudioBook:         "object.item.audioItem.audioBook",
+		MediaClassMovie:             "object.item.videoItem.movie",
+		MediaClassVideoBroadcast:    "object.item.videoItem.videoBroadcast",
+		MediaClassMusicVideoClip:    "object.item.videoItem.musicVideoClip",
+		MediaClassPlaylistItem:      "object.item.playlistItem",
+		MediaClassTextItem:          "object.item.textItem",
+		MediaClassPerson:            "object.container.person",
+		MediaClassAlbum:             "object.container.album",
+		MediaClassGenre:             "object.container.genre",
+		MediaClassMovieGenre:        "object.container.genre.movieGenre",
+		MediaClassStorageSystem:     "object.container.storageSystem",
+		MediaClassStorageVolume:     "object.container.storageVolume",
+	}[c]
+}
+
+// Container tells if the class is a container class.
+func (c MediaClass) Container() bool {
+	return c.DerivedFrom("object.container")
+}
+
+// DerivedFrom tells if the class is the class named name or one of its subclasses.
+func (c MediaClass) DerivedFrom(name string) bool {
+	s := c.String()
+	return s == name || strings.HasPrefix(s, name+".")
+}
+
+// Allows tells if the objects of the class can have the property, e.g. upnp:artist.
+// Properties of a class are also allowed for its subclasses.
+func (c MediaClass) Allows(property string) bool {
+	for name := c.String(); name != ""; {
+		for _, p := range classProperties[name] {
+			if p == property {
+				return true
+			}
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return false
+}
+
+// classProperties are the optional properties defined by each class of the ContentDirectory service.
+// upnp:albumArtURI is allowed for every class as in DLNA.
+var classProperties = map[string][]string{
+	"object":                               {"upnp:albumArtURI"},
+	"object.item":                          {"@refID"},
+	"object.item.imageItem":                {"upnp:longDescription", "upnp:storageMedium", "upnp:rating", "dc:description", "dc:publisher", "dc:date", "dc:rights"},
+	"object.item.imageItem.photo":          {"upnp:album"},
+	"object.item.audioItem":                {"upnp:genre", "dc:description", "upnp:longDescription", "dc:publisher", "dc:language", "dc:relation", "dc:rights"},
+	"object.item.audioItem.musicTrack":     {"upnp:artist", "upnp:album", "upnp:originalTrackNumber", "upnp:playlist", "upnp:storageMedium", "dc:contributor", "dc:date"},
+	"object.item.audioItem.audioBroadcast": {"upnp:region", "upnp:radioCallSign", "upnp:radioStationID", "upnp:radioBand", "upnp:channelNr"},
+	"object.item.audioItem.audioBook":      {"upnp:storageMedium", "upnp:producer", "dc:contributor", "dc:date"},
+	"object.item.videoItem":                {"upnp:genre", "upnp:longDescription", "upnp:producer", "upnp:rating", "upnp:actor", "upnp:director", "dc:description", "dc:publisher", "dc:language", "dc:relation"},
+	"object.item.videoItem.movie":          {"upnp:storageMedium", "upnp:DVDRegionCode", "upnp:channelName", "upnp:scheduledStartTime", "upnp:scheduledEndTime"},
+	"object.item.videoItem.videoBroadcast": {"upnp:icon", "upnp:region", "upnp:channelNr"},
+	"object.item.videoItem.musicVideoClip": {"upnp:artist", "upnp:storageMedium", "upnp:album", "upnp:scheduledStartTime", "upnp:scheduledEndTime", "upnp:director", "dc:contributor", "dc:date"},
+	"object.item.playlistItem":             {"upnp:artist", "upnp:genre", "upnp:longDescription", "upnp:storageMedium", "dc:description", "dc:date", "dc:language"},
+	"object.item.textItem":                 {"upnp:author", "upnp:protection", "upnp:longDescription", "upnp:storageMedium", "upnp:rating", "dc:description", "dc:publisher", "dc:contributor", "dc:date", "dc:relation", "dc:language", "dc:rights"},
+	"object.container":                     {"@childCount", "upnp:createClass", "upnp:searchClass", "@searchable"},
+	"object.container.person":              {"dc:language"},
+	"object.container.person.musicArtist":  {"upnp:genre", "upnp:artistDiscographyURI"},
+	"object.container.playlistContainer":   {"upnp:artist", "upnp:genre", "upnp:longDescription", "upnp:producer", "upnp:storageMedium", "dc:description", "dc:contributor", "dc:date", "dc:language", "dc:rights"},
+	"object.container.album":               {"upnp:storageMedium", "upnp:longDescription", "dc:description", "dc:publisher", "dc:contributor", "dc:date", "dc:relation", "dc:rights"},
+	"object.container.album.musicAlbum":    {"upnp:artist", "upnp:genre", "upnp:producer", "upnp:toc"},
+	"object.container.genre":               {"upnp:longDescription", "dc:description"},
+	"object.container.storageSystem":       {"upnp:storageTotal", "upnp:storageUsed", "upnp:storageFree", "upnp:storageMaxPartition", "upnp:storageMedium"},
+	"object.container.storageVolume":       {"upnp:storageTotal", "upnp:storageUsed", "upnp:storageFree", "upnp:storageMedium"},
+	"object.container.storageFolder":       {"upnp:storageUsed"},
+}
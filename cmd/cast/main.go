@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,6 +10,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -22,13 +26,23 @@ const (
 	defaultHTTPPort   = 8200
 	defaultSearchPort = 1900
 	defaultInterval   = 3 * time.Second
+	defaultRecent     = 50
 )
 
 const wants = net.FlagUp | net.FlagBroadcast | net.FlagMulticast
 
 var defaultInterface string
 
+var defaultIndex string
+
+var defaultThumbnails string
+
 func init() {
+	if dir, err := os.UserCacheDir(); err == nil {
+		defaultIndex = filepath.Join(dir, "cast", "index")
+		defaultThumbnails = filepath.Join(dir, "cast", "thumbnails")
+	}
+
 	is, err := net.Interfaces()
 	if err != nil {
 		return
@@ -47,17 +61,47 @@ func main() {
 	var name string
 	var port int
 	var interval time.Duration
-	var dir string
+	var roots rootsFlag
+	var index string
+	var thumbnails string
+	var transcoder string
+	var transcodeProfiles string
+	var transcodes int
+	var workers int
+	var ignore stringsFlag
+	var hidden bool
+	var followSymlinks bool
+	var duplicates bool
+	var allFiles bool
+	var recent int
+	var recentAge time.Duration
 	var verbose bool
 
 	flag.StringVar(&iface, "interface", defaultInterface, "network interface")
 	flag.StringVar(&name, "name", "Cast", "friendly name that appears on your player device")
 	flag.IntVar(&port, "port", defaultHTTPPort, "HTTP port")
 	flag.DurationVar(&interval, "interval", defaultInterval, "advertise interval")
-	flag.StringVar(&dir, "dir", ".", "path to the directory containing media files")
+	flag.Var(&roots, "dir", "path to the directory containing media files, optionally labeled as `label=path` (repeatable)")
+	flag.StringVar(&index, "index", defaultIndex, "path to the index file which speeds up scanning (empty to disable)")
+	flag.StringVar(&thumbnails, "thumbnails", defaultThumbnails, "path to the directory which caches resized images (empty to disable)")
+	flag.StringVar(&transcoder, "transcoder", "", "path to ffmpeg which transcodes media files on the fly (empty to disable)")
+	flag.StringVar(&transcodeProfiles, "transcode-profiles", "", "path to the JSON file of transcode profiles (empty for the default H.264 and MP3 profiles)")
+	flag.IntVar(&transcodes, "transcodes", 1, "number of media files transcoded at once")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "number of files examined concurrently while scanning")
+	flag.Var(&ignore, "ignore", "gitignore-style `pattern` of files to exclude (repeatable)")
+	flag.BoolVar(&hidden, "hidden", false, "publishes files whose names start with a dot")
+	flag.BoolVar(&followSymlinks, "follow-symlinks", false, "walks into symlinked directories")
+	flag.BoolVar(&duplicates, "duplicates", false, "publishes symlinked directories even if their targets are already published")
+	flag.BoolVar(&allFiles, "all-files", false, "publishes files other than images, audio and videos")
+	flag.IntVar(&recent, "recent", defaultRecent, "number of items in the Recently Added folder (0 to disable)")
+	flag.DurationVar(&recentAge, "recent-age", 0, "excludes items added longer ago than this from the Recently Added folder (0 for no limit)")
 	flag.BoolVar(&verbose, "verbose", false, "shows more logs")
 	flag.Parse()
 
+	if len(roots) == 0 {
+		roots = rootsFlag{{Path: "."}}
+	}
+
 	if verbose {
 		log.SetLevel(log.DebugLevel)
 	}
@@ -101,11 +145,38 @@ func main() {
 
 	go b.Run(context.Background())
 
-	ml, err := cast.NewMediaLibrary(baseURL.ResolveReference(&url.URL{Path: "/media/"}), dir)
-	if err != nil {
-		log.WithError(err).Fatal("Failed to create a media library.")
+	profiles := cast.DefaultTranscodeProfiles
+	if transcodeProfiles != "" {
+		profiles, err = loadTranscodeProfiles(transcodeProfiles)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load transcode profiles.")
+		}
 	}
 
+	ml := cast.MediaLibrary{
+		BaseURL:           baseURL.ResolveReference(&url.URL{Path: "/media/"}),
+		Roots:             roots,
+		ArtURL:            baseURL.ResolveReference(&url.URL{Path: "/art/"}),
+		IndexPath:         index,
+		ThumbnailDir:      thumbnails,
+		Transcoder:        transcoder,
+		TranscodeProfiles: profiles,
+		MaxTranscodes:     transcodes,
+		Workers:           workers,
+		Ignore:            ignore,
+		Hidden:            hidden,
+		FollowSymlinks:    followSymlinks,
+		Duplicates:        duplicates,
+		AllFiles:          allFiles,
+		Recent:            recent,
+		RecentAge:         recentAge,
+	}
+	if err := ml.Scan(); err != nil {
+		log.WithError(err).Fatal("Failed to scan a media library.")
+	}
+
+	go ml.Watch(context.Background())
+
 	desc := cast.Description{
 		BaseURL:      baseURL,
 		FriendlyName: name,
@@ -117,7 +188,8 @@ func main() {
 	mux.HandleFunc("/control", ml.Control)
 	// mux.HandleFunc("/event", nil)
 	mux.Handle("/public/", http.FileServer(http.FS(cast.Public)))
-	mux.Handle("/media/", http.StripPrefix("/media/", http.FileServer(http.FS(os.DirFS(dir)))))
+	mux.Handle("/media/", http.StripPrefix("/media", http.HandlerFunc(ml.Media)))
+	mux.Handle("/art/", http.StripPrefix("/art", http.HandlerFunc(ml.Art)))
 
 	log.WithField("url", baseURL).Info("Start HTTP server.")
 	defer log.WithField("url", baseURL).Info("Stop HTTP server.")
@@ -129,6 +201,61 @@ func main() {
 	}
 }
 
+// rootsFlag is a repeatable flag of library roots. Each value is either `path` or `label=path`.
+type rootsFlag []cast.Root
+
+func (r *rootsFlag) String() string {
+	s := make([]string, len(*r))
+	for i, root := range *r {
+		if root.Label == "" {
+			s[i] = root.Path
+			continue
+		}
+		s[i] = root.Label + "=" + root.Path
+	}
+	return strings.Join(s, ",")
+}
+
+func (r *rootsFlag) Set(v string) error {
+	var root cast.Root
+	// A path may contain =, in which case the part before it is not a label but a part of the path.
+	if i := strings.Index(v, "="); i >= 0 && !strings.ContainsAny(v[:i], "/"+string(filepath.Separator)) {
+		root.Label, root.Path = v[:i], v[i+1:]
+	} else {
+		root.Path = v
+	}
+	if root.Path == "" {
+		return errors.New("empty path")
+	}
+	*r = append(*r, root)
+	return nil
+}
+
+// stringsFlag is a repeatable flag of strings.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// loadTranscodeProfiles reads transcode profiles from a JSON array of objects with the fields of cast.TranscodeProfile.
+func loadTranscodeProfiles(path string) ([]cast.TranscodeProfile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []cast.TranscodeProfile
+	if err := json.Unmarshal(b, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
 func localAddress(i *net.Interface) (string, error) {
 	as, err := i.Addrs()
 	if err != nil {
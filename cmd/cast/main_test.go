@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ichiban/cast"
+)
+
+func TestRootsFlag_Set(t *testing.T) {
+	tests := []struct {
+		v    string
+		want cast.Root
+		err  bool
+	}{
+		{v: "/srv/media", want: cast.Root{Path: "/srv/media"}},
+		{v: "Movies=/srv/movies", want: cast.Root{Label: "Movies", Path: "/srv/movies"}},
+		{v: "Movies=a=b", want: cast.Root{Label: "Movies", Path: "a=b"}},
+		{v: "/srv/a=b", want: cast.Root{Path: "/srv/a=b"}},
+		{v: "media/a=b", want: cast.Root{Path: "media/a=b"}},
+		{v: "=/srv/media", want: cast.Root{Path: "/srv/media"}},
+		{v: "", err: true},
+		{v: "Movies=", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.v, func(t *testing.T) {
+			var r rootsFlag
+			err := r.Set(tt.v)
+			if (err != nil) != tt.err {
+				t.Fatalf("got %v", err)
+			}
+			if tt.err {
+				return
+			}
+			if len(r) != 1 || r[0] != tt.want {
+				t.Errorf("got %+v, want %+v", r, tt.want)
+			}
+		})
+	}
+}
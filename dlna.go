@@ -0,0 +1,324 @@
+package cast
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DLNA flags in DLNA.ORG_FLAGS.
+const (
+	dlnaFlagStreamingTransferMode   = 1 << 24
+	dlnaFlagInteractiveTransferMode = 1 << 23
+	dlnaFlagBackgroundTransferMode  = 1 << 22
+	dlnaFlagConnectionStall         = 1 << 21
+	dlnaFlagDLNAV15                 = 1 << 20
+)
+
+// DLNA operations in DLNA.ORG_OP.
+const (
+	dlnaOpTimeSeek = 1 << 1
+	dlnaOpRange    = 1 << 0
+)
+
+// H.264 profiles in profile_idc.
+const (
+	avcProfileBaseline = 66
+	avcProfileMain     = 77
+	avcProfileHigh     = 100
+)
+
+// protocolInfo returns the protocol info of a resource served over HTTP.
+// For images, audio and videos, its fourth field has the DLNA media format profile, if any, and the DLNA operations and flags.
+// converted tells if the resource is converted from the original, e.g. a resized image.
+// ops are the DLNA operations supported for the resource, i.e. seeking by byte ranges and by TimeSeekRange.dlna.org.
+func protocolInfo(mime, profile string, converted bool, ops int) string {
+	var flags uint32
+	switch strings.Split(mime, "/")[0] {
+	case "image":
+		flags = dlnaFlagInteractiveTransferMode | dlnaFlagBackgroundTransferMode | dlnaFlagDLNAV15
+	case "audio", "video":
+		flags = dlnaFlagStreamingTransferMode | dlnaFlagBackgroundTransferMode | dlnaFlagConnectionStall | dlnaFlagDLNAV15
+	default:
+		return "http-get:*:" + mime + ":*"
+	}
+
+	var params []string
+	if profile != "" {
+		params = append(params, "DLNA.ORG_PN="+profile)
+	}
+	params = append(params, fmt.Sprintf("DLNA.ORG_OP=%d%d", ops>>1&1, ops&1))
+	if converted {
+		params = append(params, "DLNA.ORG_CI=1")
+	} else {
+		params = append(params, "DLNA.ORG_CI=0")
+	}
+	params = append(params, "DLNA.ORG_FLAGS="+dlnaFlags(flags))
+	return "http-get:*:" + mime + ":" + strings.Join(params, ";")
+}
+
+// dlnaFlags formats the flags as the primary flags followed by the reserved ones, 32 hexadecimal digits in total.
+func dlnaFlags(flags uint32) string {
+	const hex = "0123456789ABCDEF"
+	b := []byte(strings.Repeat("0", 32))
+	for i := 7; i >= 0; i-- {
+		b[i] = hex[flags&0xf]
+		flags >>= 4
+	}
+	return string(b)
+}
+
+// dlnaProfile returns the DLNA media format profile of the media file by its container, codecs and resolution.
+// It returns "" if the file conforms to none of the profiles known to it.
+func dlnaProfile(mime string, md *metadata) string {
+	switch mime {
+	case "image/jpeg":
+		return imageProfile(md, []sizedProfile{
+			{name: "JPEG_SM", width: 640, height: 480},
+			{name: "JPEG_MED", width: 1024, height: 768},
+			{name: "JPEG_LRG", width: 4096, height: 4096},
+		})
+	case "image/png":
+		return imageProfile(md, []sizedProfile{
+			{name: "PNG_LRG", width: 4096, height: 4096},
+		})
+	case "image/gif":
+		return imageProfile(md, []sizedProfile{
+			{name: "GIF_LRG", width: 1600, height: 1200},
+		})
+	case "audio/mpeg":
+		return "MP3"
+	case "audio/wav":
+		// LPCM is of raw big-endian samples served as audio/L16, not of little-endian samples in RIFF.
+		return ""
+	case "audio/ac3":
+		return "AC3"
+	case "audio/aac", "audio/x-aac":
+		if aac320(md) {
+			return "AAC_ADTS_320"
+		}
+		return "AAC_ADTS"
+	case "audio/mp4", "audio/x-m4a":
+		if md.AudioCodec != "aac" {
+			return ""
+		}
+		if aac320(md) {
+			return "AAC_ISO_320"
+		}
+		return "AAC_ISO"
+	case "video/mp4", "video/x-m4v":
+		return mp4Profile(md)
+	case "video/mp2t":
+		return tsProfile(md)
+	default:
+		return ""
+	}
+}
+
+// sizedProfile is a DLNA media format profile of images with the maximum size.
+type sizedProfile struct {
+	name          string
+	width, height int
+}
+
+// imageProfile returns the smallest of the profiles, smallest first, in which the image fits.
+func imageProfile(md *metadata, profiles []sizedProfile) string {
+	if md.Width <= 0 || md.Height <= 0 {
+		return ""
+	}
+	for _, p := range profiles {
+		if md.Width <= p.width && md.Height <= p.height {
+			return p.name
+		}
+	}
+	return ""
+}
+
+// aac320 tells if the AAC audio is within 320 kbps, 2 channels and 48 kHz.
+func aac320(md *metadata) bool {
+	return md.Bitrate > 0 && md.Bitrate <= 320000/8 && md.Channels > 0 && md.Channels <= 2 && md.SampleRate <= 48000
+}
+
+// mp4Profile returns the DLNA media format profile of an MP4 video.
+func mp4Profile(md *metadata) string {
+	var audio string
+	switch md.AudioCodec {
+	case "aac", "":
+		audio = "AAC"
+	case "ac3":
+		audio = "AC3"
+	default:
+		return ""
+	}
+
+	var (
+		sd = md.Width <= 720 && md.Height <= 576
+		hd = md.Width <= 1920 && md.Height <= 1080
+	)
+	switch md.VideoCodec {
+	case "h264":
+		switch {
+		case md.VideoProfile == avcProfileBaseline && md.Width <= 352 && md.Height <= 288 && audio == "AAC":
+			return "AVC_MP4_BL_CIF15_AAC_520"
+		case md.VideoProfile == avcProfileBaseline && sd && audio == "AAC":
+			return "AVC_MP4_BL_L3L_SD_AAC"
+		case md.VideoProfile <= avcProfileMain && sd && audio == "AAC":
+			return "AVC_MP4_MP_SD_AAC_MULT5"
+		case md.VideoProfile <= avcProfileMain && sd:
+			return "AVC_MP4_MP_SD_AC3"
+		case md.VideoProfile <= avcProfileMain && md.Width <= 1280 && md.Height <= 720 && audio == "AAC":
+			return "AVC_MP4_MP_HD_720p_AAC"
+		case md.VideoProfile <= avcProfileMain && hd && audio == "AAC":
+			return "AVC_MP4_MP_HD_1080i_AAC"
+		case md.VideoProfile <= avcProfileHigh && hd && audio == "AAC":
+			return "AVC_MP4_HP_HD_AAC"
+		}
+	case "mpeg4":
+		if sd && audio == "AAC" {
+			return "MPEG4_P2_MP4_ASP_AAC"
+		}
+	}
+	return ""
+}
+
+// tsProfile returns the DLNA media format profile of an MPEG transport stream.
+// The profile names are suffixed by _ISO for 188-byte packets and by _T for 192-byte ones with valid timestamps.
+func tsProfile(md *metadata) string {
+	if md.Width <= 0 || md.Height <= 0 {
+		return ""
+	}
+	var audio string
+	switch md.AudioCodec {
+	case "aac", "":
+		audio = "AAC"
+	case "ac3":
+		audio = "AC3"
+	case "mp2":
+		audio = "MPEG1_L2"
+	default:
+		return ""
+	}
+
+	var (
+		sd = md.Width <= 720 && md.Height <= 576
+		hd = md.Width <= 1920 && md.Height <= 1080
+	)
+	var name string
+	switch md.VideoCodec {
+	case "mpeg2":
+		switch {
+		case audio == "AC3" && md.Width <= 720 && md.Height <= 480:
+			name = "MPEG_TS_SD_NA"
+		case (audio == "AC3" || audio == "MPEG1_L2") && sd:
+			name = "MPEG_TS_SD_EU"
+		case audio == "AC3" && hd:
+			name = "MPEG_TS_HD_NA"
+		}
+	case "h264":
+		switch {
+		case md.VideoProfile <= avcProfileMain && sd && audio == "AAC":
+			name = "AVC_TS_MP_SD_AAC_MULT5"
+		case md.VideoProfile <= avcProfileMain && sd && audio == "AC3":
+			name = "AVC_TS_MP_SD_AC3"
+		case md.VideoProfile <= avcProfileMain && hd && audio == "AAC":
+			name = "AVC_TS_MP_HD_AAC_MULT5"
+		case md.VideoProfile <= avcProfileMain && hd && audio == "AC3":
+			name = "AVC_TS_MP_HD_AC3"
+		}
+	}
+	switch {
+	case name == "":
+		return ""
+	case md.TSPacketSize == tsPacketSize:
+		return name + "_ISO"
+	case md.TSTimestamped:
+		return name + "_T"
+	default:
+		return name
+	}
+}
+
+// DLNA transfer modes in transferMode.dlna.org.
+var transferModes = []struct {
+	name string
+	flag uint32
+}{
+	{name: "Streaming", flag: dlnaFlagStreamingTransferMode},
+	{name: "Interactive", flag: dlnaFlagInteractiveTransferMode},
+	{name: "Background", flag: dlnaFlagBackgroundTransferMode},
+}
+
+// dlnaHeaders negotiates the transfer mode of the resource with the protocol info and sets the DLNA headers of the response.
+// If the client asks for a transfer mode which the resource doesn't support, it responds with 406 and returns false.
+func dlnaHeaders(w http.ResponseWriter, r *http.Request, protocolInfo string) bool {
+	fields := strings.SplitN(protocolInfo, ":", 4)
+	if len(fields) < 4 {
+		return true
+	}
+	mime, features := fields[2], fields[3]
+
+	flags, ok := featureFlags(features)
+	if !ok {
+		// Without DLNA flags, audio and videos are streamed and the others are transferred interactively.
+		switch strings.Split(mime, "/")[0] {
+		case "audio", "video":
+			flags = dlnaFlagStreamingTransferMode | dlnaFlagBackgroundTransferMode
+		default:
+			flags = dlnaFlagInteractiveTransferMode | dlnaFlagBackgroundTransferMode
+		}
+	}
+
+	var mode string
+	if req := r.Header.Get("transferMode.dlna.org"); req != "" {
+		for _, m := range transferModes {
+			if strings.EqualFold(req, m.name) && flags&m.flag != 0 {
+				mode = m.name
+			}
+		}
+		if mode == "" {
+			http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+			return false
+		}
+	} else {
+		for _, m := range transferModes {
+			if flags&m.flag != 0 {
+				mode = m.name
+				break
+			}
+		}
+	}
+
+	switch r.Header.Get("getcontentFeatures.dlna.org") {
+	case "":
+	case "1":
+		// Set it as is since some TVs don't recognize the canonicalized Contentfeatures.dlna.org.
+		w.Header()["contentFeatures.dlna.org"] = []string{features}
+	default:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return false
+	}
+	if mode != "" {
+		w.Header()["transferMode.dlna.org"] = []string{mode}
+	}
+	return true
+}
+
+// featureFlags returns the primary flags in DLNA.ORG_FLAGS of the fourth field of a protocol info, or false if there's none.
+func featureFlags(features string) (uint32, bool) {
+	for _, p := range strings.Split(features, ";") {
+		if !strings.HasPrefix(p, "DLNA.ORG_FLAGS=") {
+			continue
+		}
+		v := strings.TrimPrefix(p, "DLNA.ORG_FLAGS=")
+		if len(v) < 8 {
+			return 0, false
+		}
+		flags, err := strconv.ParseUint(v[:8], 16, 32)
+		if err != nil {
+			return 0, false
+		}
+		return uint32(flags), true
+	}
+	return 0, false
+}
@@ -0,0 +1,177 @@
+package cast
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDLNAProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		mime string
+		md   metadata
+		want string
+	}{
+		{name: "small JPEG", mime: "image/jpeg", md: metadata{Width: 640, Height: 480}, want: "JPEG_SM"},
+		{name: "medium JPEG", mime: "image/jpeg", md: metadata{Width: 1024, Height: 768}, want: "JPEG_MED"},
+		{name: "large JPEG", mime: "image/jpeg", md: metadata{Width: 4000, Height: 3000}, want: "JPEG_LRG"},
+		{name: "huge JPEG", mime: "image/jpeg", md: metadata{Width: 8000, Height: 6000}, want: ""},
+		{name: "JPEG of unknown size", mime: "image/jpeg", want: ""},
+		{name: "PNG", mime: "image/png", md: metadata{Width: 1920, Height: 1080}, want: "PNG_LRG"},
+		{name: "GIF", mime: "image/gif", md: metadata{Width: 320, Height: 240}, want: "GIF_LRG"},
+		{name: "large GIF", mime: "image/gif", md: metadata{Width: 1920, Height: 1080}, want: ""},
+		{name: "MP3", mime: "audio/mpeg", want: "MP3"},
+		{name: "WAV", mime: "audio/wav", md: metadata{AudioCodec: "lpcm", Channels: 2, SampleRate: 44100}, want: ""},
+		{name: "AC-3", mime: "audio/ac3", want: "AC3"},
+		{name: "ADTS", mime: "audio/aac", md: metadata{Bitrate: 256000 / 8, Channels: 2, SampleRate: 44100}, want: "AAC_ADTS_320"},
+		{name: "ADTS in 6 channels", mime: "audio/aac", md: metadata{Bitrate: 256000 / 8, Channels: 6, SampleRate: 48000}, want: "AAC_ADTS"},
+		{name: "M4A", mime: "audio/mp4", md: metadata{AudioCodec: "aac", Bitrate: 128000 / 8, Channels: 2, SampleRate: 44100}, want: "AAC_ISO_320"},
+		{name: "M4A at high bitrate", mime: "audio/x-m4a", md: metadata{AudioCodec: "aac", Bitrate: 512000 / 8, Channels: 2, SampleRate: 44100}, want: "AAC_ISO"},
+		{name: "ALAC", mime: "audio/mp4", md: metadata{AudioCodec: "alac"}, want: ""},
+		{name: "MP4", mime: "video/mp4", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileHigh, Width: 1920, Height: 1080}, want: "AVC_MP4_HP_HD_AAC"},
+		{name: "TS", mime: "video/mp2t", md: metadata{VideoCodec: "h264", AudioCodec: "ac3", VideoProfile: avcProfileMain, Width: 1920, Height: 1080, TSPacketSize: 192}, want: "AVC_TS_MP_HD_AC3"},
+		{name: "Matroska", mime: "video/x-matroska", md: metadata{VideoCodec: "h264", AudioCodec: "aac"}, want: ""},
+		{name: "FLAC", mime: "audio/flac", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dlnaProfile(tt.mime, &tt.md); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMP4Profile(t *testing.T) {
+	tests := []struct {
+		name string
+		md   metadata
+		want string
+	}{
+		{name: "baseline CIF", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileBaseline, Width: 352, Height: 288}, want: "AVC_MP4_BL_CIF15_AAC_520"},
+		{name: "baseline SD", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileBaseline, Width: 640, Height: 480}, want: "AVC_MP4_BL_L3L_SD_AAC"},
+		{name: "main SD", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileMain, Width: 720, Height: 576}, want: "AVC_MP4_MP_SD_AAC_MULT5"},
+		{name: "main SD with AC-3", md: metadata{VideoCodec: "h264", AudioCodec: "ac3", VideoProfile: avcProfileMain, Width: 720, Height: 480}, want: "AVC_MP4_MP_SD_AC3"},
+		{name: "main 720p", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileMain, Width: 1280, Height: 720}, want: "AVC_MP4_MP_HD_720p_AAC"},
+		{name: "main 1080", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileMain, Width: 1920, Height: 1080}, want: "AVC_MP4_MP_HD_1080i_AAC"},
+		{name: "high 1080", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileHigh, Width: 1920, Height: 1080}, want: "AVC_MP4_HP_HD_AAC"},
+		{name: "high 1080 with AC-3", md: metadata{VideoCodec: "h264", AudioCodec: "ac3", VideoProfile: avcProfileHigh, Width: 1920, Height: 1080}, want: ""},
+		{name: "high 4K", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileHigh, Width: 3840, Height: 2160}, want: ""},
+		{name: "High 10", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: 110, Width: 1920, Height: 1080}, want: ""},
+		{name: "no audio", md: metadata{VideoCodec: "h264", VideoProfile: avcProfileMain, Width: 1280, Height: 720}, want: "AVC_MP4_MP_HD_720p_AAC"},
+		{name: "MPEG-4 part 2", md: metadata{VideoCodec: "mpeg4", AudioCodec: "aac", Width: 640, Height: 480}, want: "MPEG4_P2_MP4_ASP_AAC"},
+		{name: "MPEG-4 part 2 HD", md: metadata{VideoCodec: "mpeg4", AudioCodec: "aac", Width: 1280, Height: 720}, want: ""},
+		{name: "HEVC", md: metadata{VideoCodec: "hevc", AudioCodec: "aac", Width: 1920, Height: 1080}, want: ""},
+		{name: "Opus", md: metadata{VideoCodec: "h264", AudioCodec: "opus", VideoProfile: avcProfileMain, Width: 1280, Height: 720}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mp4Profile(&tt.md); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTSProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		md   metadata
+		want string
+	}{
+		{name: "H.264 SD AAC", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileMain, Width: 720, Height: 576, TSPacketSize: 188}, want: "AVC_TS_MP_SD_AAC_MULT5_ISO"},
+		{name: "H.264 SD AC-3", md: metadata{VideoCodec: "h264", AudioCodec: "ac3", VideoProfile: avcProfileMain, Width: 720, Height: 480, TSPacketSize: 192, TSTimestamped: true}, want: "AVC_TS_MP_SD_AC3_T"},
+		{name: "H.264 HD AAC", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileMain, Width: 1920, Height: 1080, TSPacketSize: 192}, want: "AVC_TS_MP_HD_AAC_MULT5"},
+		{name: "H.264 high profile", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileHigh, Width: 1920, Height: 1080, TSPacketSize: 188}, want: ""},
+		{name: "H.264 4K", md: metadata{VideoCodec: "h264", AudioCodec: "aac", VideoProfile: avcProfileMain, Width: 3840, Height: 2160, TSPacketSize: 188}, want: ""},
+		{name: "H.264 of unknown size", md: metadata{VideoCodec: "h264", AudioCodec: "aac", TSPacketSize: 188}, want: ""},
+		{name: "MPEG-2 NTSC", md: metadata{VideoCodec: "mpeg2", AudioCodec: "ac3", Width: 720, Height: 480, TSPacketSize: 188}, want: "MPEG_TS_SD_NA_ISO"},
+		{name: "MPEG-2 PAL AC-3", md: metadata{VideoCodec: "mpeg2", AudioCodec: "ac3", Width: 720, Height: 576, TSPacketSize: 192}, want: "MPEG_TS_SD_EU"},
+		{name: "MPEG-2 PAL MPEG audio", md: metadata{VideoCodec: "mpeg2", AudioCodec: "mp2", Width: 720, Height: 576, TSPacketSize: 188}, want: "MPEG_TS_SD_EU_ISO"},
+		{name: "MPEG-2 HD", md: metadata{VideoCodec: "mpeg2", AudioCodec: "ac3", Width: 1920, Height: 1080, TSPacketSize: 192, TSTimestamped: true}, want: "MPEG_TS_HD_NA_T"},
+		{name: "MPEG-2 HD AAC", md: metadata{VideoCodec: "mpeg2", AudioCodec: "aac", Width: 1920, Height: 1080, TSPacketSize: 188}, want: ""},
+		{name: "HEVC", md: metadata{VideoCodec: "hevc", AudioCodec: "aac", Width: 1920, Height: 1080, TSPacketSize: 188}, want: ""},
+		{name: "E-AC-3", md: metadata{VideoCodec: "h264", AudioCodec: "eac3", VideoProfile: avcProfileMain, Width: 1920, Height: 1080, TSPacketSize: 188}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tsProfile(&tt.md); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDLNAHeaders(t *testing.T) {
+	const (
+		video      = "http-get:*:video/mp4:DLNA.ORG_PN=AVC_MP4_MP_SD_AAC_MULT5;DLNA.ORG_OP=01;DLNA.ORG_FLAGS=01500000000000000000000000000000"
+		image      = "http-get:*:image/jpeg:DLNA.ORG_PN=JPEG_LRG;DLNA.ORG_OP=01;DLNA.ORG_FLAGS=00d00000000000000000000000000000"
+		audio      = "http-get:*:audio/flac:*"
+		text       = "http-get:*:text/plain:*"
+		badFlags   = "http-get:*:video/mp4:DLNA.ORG_FLAGS=zz"
+		noFeatures = "http-get:*:video/mp4"
+	)
+	tests := []struct {
+		name         string
+		method       string
+		protocolInfo string
+		header       map[string]string
+		want         bool
+		code         int
+		mode         string
+		features     string
+	}{
+		{name: "video", protocolInfo: video, want: true, mode: "Streaming"},
+		{name: "image", protocolInfo: image, want: true, mode: "Interactive"},
+		{name: "audio without flags", protocolInfo: audio, want: true, mode: "Streaming"},
+		{name: "others without flags", protocolInfo: text, want: true, mode: "Interactive"},
+		{name: "malformed flags", protocolInfo: badFlags, want: true, mode: "Streaming"},
+		{name: "no features", protocolInfo: noFeatures, want: true},
+		{name: "streaming", protocolInfo: video, header: map[string]string{"transferMode.dlna.org": "Streaming"}, want: true, mode: "Streaming"},
+		{name: "background", protocolInfo: video, header: map[string]string{"transferMode.dlna.org": "Background"}, want: true, mode: "Background"},
+		{name: "case-insensitive", protocolInfo: image, header: map[string]string{"transferMode.dlna.org": "interactive"}, want: true, mode: "Interactive"},
+		{name: "interactive video", protocolInfo: video, header: map[string]string{"transferMode.dlna.org": "Interactive"}, code: http.StatusNotAcceptable},
+		{name: "streaming image", protocolInfo: image, header: map[string]string{"transferMode.dlna.org": "Streaming"}, code: http.StatusNotAcceptable},
+		{name: "streaming others without flags", protocolInfo: text, header: map[string]string{"transferMode.dlna.org": "Streaming"}, code: http.StatusNotAcceptable},
+		{name: "unknown mode", protocolInfo: video, header: map[string]string{"transferMode.dlna.org": "Bulk"}, code: http.StatusNotAcceptable},
+		{name: "content features", protocolInfo: video, header: map[string]string{"getcontentFeatures.dlna.org": "1"}, want: true, mode: "Streaming", features: "DLNA.ORG_PN=AVC_MP4_MP_SD_AAC_MULT5;DLNA.ORG_OP=01;DLNA.ORG_FLAGS=01500000000000000000000000000000"},
+		{name: "content features without flags", protocolInfo: audio, header: map[string]string{"getcontentFeatures.dlna.org": "1"}, want: true, mode: "Streaming", features: "*"},
+		{name: "content features of HEAD", method: http.MethodHead, protocolInfo: image, header: map[string]string{"getcontentFeatures.dlna.org": "1", "transferMode.dlna.org": "Background"}, want: true, mode: "Background", features: "DLNA.ORG_PN=JPEG_LRG;DLNA.ORG_OP=01;DLNA.ORG_FLAGS=00d00000000000000000000000000000"},
+		{name: "mismatch of HEAD", method: http.MethodHead, protocolInfo: video, header: map[string]string{"transferMode.dlna.org": "Interactive"}, code: http.StatusNotAcceptable},
+		{name: "bad content features", protocolInfo: video, header: map[string]string{"getcontentFeatures.dlna.org": "0"}, code: http.StatusBadRequest},
+		{name: "bad content features of HEAD", method: http.MethodHead, protocolInfo: video, header: map[string]string{"getcontentFeatures.dlna.org": "yes"}, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/1.mp4", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			if got := dlnaHeaders(w, r, tt.protocolInfo); got != tt.want {
+				t.Fatalf("got %t, want %t", got, tt.want)
+			}
+			if !tt.want {
+				if w.Code != tt.code {
+					t.Errorf("got %d, want %d", w.Code, tt.code)
+				}
+				return
+			}
+			if got := w.Header()["transferMode.dlna.org"]; len(got) != 0 || tt.mode != "" {
+				if len(got) != 1 || got[0] != tt.mode {
+					t.Errorf("got %q, want %q", got, tt.mode)
+				}
+			}
+			if got := w.Header()["contentFeatures.dlna.org"]; len(got) != 0 || tt.features != "" {
+				if len(got) != 1 || got[0] != tt.features {
+					t.Errorf("got %q, want %q", got, tt.features)
+				}
+			}
+		})
+	}
+}
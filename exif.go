@@ -0,0 +1,219 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// TIFF tags used by EXIF.
+const (
+	tiffTagImageWidth       = 0x0100
+	tiffTagImageLength      = 0x0101
+	tiffTagOrientation      = 0x0112
+	tiffTagDateTime         = 0x0132
+	tiffTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+	exifTagPixelXDimension  = 0xa002
+	exifTagPixelYDimension  = 0xa003
+)
+
+// TIFF field types.
+const (
+	tiffTypeASCII = 2
+	tiffTypeShort = 3
+	tiffTypeLong  = 4
+)
+
+// parseJPEG reads the dimensions and the EXIF of a JPEG file.
+func parseJPEG(r io.ReaderAt, size int64, md *metadata) error {
+	var soi [2]byte
+	if _, err := r.ReadAt(soi[:], 0); err != nil {
+		return err
+	}
+	if soi != [2]byte{0xff, 0xd8} {
+		return errMalformed
+	}
+
+	for offset := int64(2); offset+4 <= size; {
+		var h [4]byte
+		if _, err := r.ReadAt(h[:], offset); err != nil {
+			return err
+		}
+		if h[0] != 0xff {
+			return errMalformed
+		}
+		marker, n := h[1], int64(binary.BigEndian.Uint16(h[2:]))
+		switch {
+		case marker == 0xff:
+			// Fill bytes may precede markers.
+			offset++
+			continue
+		case marker == 0xd8, marker == 0x01, marker >= 0xd0 && marker <= 0xd7:
+			// Standalone markers have no length.
+			offset += 2
+			continue
+		case marker == 0xda, marker == 0xd9:
+			// The compressed data follows the start of scan.
+			return nil
+		}
+		if n < 2 {
+			return errMalformed
+		}
+		payload := io.NewSectionReader(r, offset+4, n-2)
+
+		switch {
+		case marker == 0xe1:
+			var id [6]byte
+			if _, err := payload.ReadAt(id[:], 0); err == nil && string(id[:]) == "Exif\x00\x00" {
+				if err := parseEXIF(io.NewSectionReader(payload, 6, n-2-6), md); err != nil {
+					return err
+				}
+			}
+		case marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			// Start of frame has the precision followed by the height and the width, which take precedence over the EXIF.
+			var b [5]byte
+			if _, err := payload.ReadAt(b[:], 0); err != nil {
+				return err
+			}
+			md.Height, md.Width = int(binary.BigEndian.Uint16(b[1:])), int(binary.BigEndian.Uint16(b[3:]))
+		}
+		offset += 2 + n
+	}
+	return nil
+}
+
+// parseTIFF reads the dimensions and the EXIF of a TIFF file.
+func parseTIFF(r io.ReaderAt, size int64, md *metadata) error {
+	return parseEXIF(io.NewSectionReader(r, 0, size), md)
+}
+
+// parseEXIF reads the orientation, the date when the picture was taken and the dimensions from TIFF structured data.
+// The dimensions in the EXIF are used only if they are not known yet.
+func parseEXIF(r io.ReaderAt, md *metadata) error {
+	var h [8]byte
+	if _, err := r.ReadAt(h[:], 0); err != nil {
+		return err
+	}
+	var order binary.ByteOrder
+	switch string(h[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return errMalformed
+	}
+	if order.Uint16(h[2:]) != 42 {
+		return errMalformed
+	}
+
+	ifd0, err := readIFD(r, order, int64(order.Uint32(h[4:])))
+	if err != nil {
+		return err
+	}
+	var exif map[uint16]tiffField
+	if f, ok := ifd0[tiffTagExifIFD]; ok {
+		exif, _ = readIFD(r, order, int64(f.uint()))
+	}
+
+	if md.Width == 0 {
+		md.Width, md.Height = int(ifd0[tiffTagImageWidth].uint()), int(ifd0[tiffTagImageLength].uint())
+	}
+	if md.Width == 0 {
+		md.Width, md.Height = int(exif[exifTagPixelXDimension].uint()), int(exif[exifTagPixelYDimension].uint())
+	}
+	md.Orientation = int(ifd0[tiffTagOrientation].uint())
+	if d := exifDate(exif[exifTagDateTimeOriginal].ascii()); d != "" {
+		md.Date = d
+	} else {
+		md.Date = exifDate(ifd0[tiffTagDateTime].ascii())
+	}
+	return nil
+}
+
+// tiffField is a field of an image file directory.
+type tiffField struct {
+	typ   uint16
+	count uint32
+	value []byte
+	order binary.ByteOrder
+}
+
+// uint returns the first value of a SHORT or LONG field.
+func (f tiffField) uint() uint32 {
+	switch {
+	case f.typ == tiffTypeShort && len(f.value) >= 2:
+		return uint32(f.order.Uint16(f.value))
+	case f.typ == tiffTypeLong && len(f.value) >= 4:
+		return f.order.Uint32(f.value)
+	default:
+		return 0
+	}
+}
+
+// ascii returns the value of an ASCII field.
+func (f tiffField) ascii() string {
+	if f.typ != tiffTypeASCII {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes.TrimRight(f.value, "\x00")))
+}
+
+// tiffFieldLimit is the maximum size of a field value. Larger ones, e.g. maker notes, are skipped.
+const tiffFieldLimit = 4 << 10
+
+// readIFD reads the SHORT, LONG and ASCII fields of the image file directory at offset.
+func readIFD(r io.ReaderAt, order binary.ByteOrder, offset int64) (map[uint16]tiffField, error) {
+	var n [2]byte
+	if _, err := r.ReadAt(n[:], offset); err != nil {
+		return nil, err
+	}
+	b := make([]byte, 12*int(order.Uint16(n[:])))
+	if _, err := r.ReadAt(b, offset+2); err != nil {
+		return nil, err
+	}
+
+	fields := map[uint16]tiffField{}
+	for ; len(b) >= 12; b = b[12:] {
+		f := tiffField{
+			typ:   order.Uint16(b[2:]),
+			count: order.Uint32(b[4:]),
+			order: order,
+		}
+		var unit uint64
+		switch f.typ {
+		case tiffTypeASCII:
+			unit = 1
+		case tiffTypeShort:
+			unit = 2
+		case tiffTypeLong:
+			unit = 4
+		default:
+			continue
+		}
+		size := unit * uint64(f.count)
+		switch {
+		case size > tiffFieldLimit:
+			continue
+		case size <= 4:
+			f.value = b[8 : 8+size]
+		default:
+			f.value = make([]byte, size)
+			if _, err := r.ReadAt(f.value, int64(order.Uint32(b[8:]))); err != nil {
+				continue
+			}
+		}
+		fields[order.Uint16(b)] = f
+	}
+	return fields, nil
+}
+
+// exifDate converts an EXIF date and time, e.g. "2004:05:06 12:34:56", into the form of YYYY-MM-DDTHH:MM:SS.
+func exifDate(s string) string {
+	if len(s) < 19 || strings.HasPrefix(s, "0000") || s[4] != ':' || s[7] != ':' || s[10] != ' ' {
+		return ""
+	}
+	return s[:4] + "-" + s[5:7] + "-" + s[8:10] + "T" + s[11:19]
+}
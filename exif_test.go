@@ -0,0 +1,162 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// tiff returns a little-endian TIFF whose IFD0 has the fields. Each field is a tag, a type and a value.
+// ASCII values are stored after the IFD and SHORT and LONG ones in the field.
+func tiff(fields ...interface{}) []byte {
+	n := len(fields) / 3
+	data := 8 + 2 + 12*n + 4
+	ifd := make([]byte, 2, 2+12*n+4)
+	binary.LittleEndian.PutUint16(ifd, uint16(n))
+	var extra []byte
+	for i := 0; i+2 < len(fields); i += 3 {
+		e := make([]byte, 12)
+		binary.LittleEndian.PutUint16(e, fields[i].(uint16))
+		binary.LittleEndian.PutUint16(e[2:], fields[i+1].(uint16))
+		switch v := fields[i+2].(type) {
+		case string:
+			binary.LittleEndian.PutUint32(e[4:], uint32(len(v)+1))
+			binary.LittleEndian.PutUint32(e[8:], uint32(data+len(extra)))
+			extra = append(extra, v+"\x00"...)
+		case int:
+			binary.LittleEndian.PutUint32(e[4:], 1)
+			if fields[i+1].(uint16) == tiffTypeShort {
+				binary.LittleEndian.PutUint16(e[8:], uint16(v))
+			} else {
+				binary.LittleEndian.PutUint32(e[8:], uint32(v))
+			}
+		}
+		ifd = append(ifd, e...)
+	}
+	ifd = append(ifd, 0, 0, 0, 0)
+	b := append([]byte("II\x2a\x00\x08\x00\x00\x00"), ifd...)
+	return append(b, extra...)
+}
+
+func TestParseJPEG(t *testing.T) {
+	b, err := os.ReadFile("testdata/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var md metadata
+	if err := parseJPEG(bytes.NewReader(b), int64(len(b)), &md); err != nil {
+		t.Fatal(err)
+	}
+	// The date when the picture was taken takes precedence over when the file was changed.
+	want := metadata{Width: 32, Height: 16, Orientation: 6, Date: "2004-05-06T12:34:56"}
+	if md.Width != want.Width || md.Height != want.Height || md.Orientation != want.Orientation || md.Date != want.Date {
+		t.Errorf("got %+v, want %+v", md, want)
+	}
+}
+
+func TestParseTIFF(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want metadata
+		err  error
+	}{
+		{
+			name: "dimensions in IFD0",
+			data: tiff(
+				uint16(tiffTagImageWidth), uint16(tiffTypeShort), 640,
+				uint16(tiffTagImageLength), uint16(tiffTypeLong), 480,
+				uint16(tiffTagOrientation), uint16(tiffTypeShort), 8,
+				uint16(tiffTagDateTime), uint16(tiffTypeASCII), "2001:02:03 04:05:06",
+			),
+			want: metadata{Width: 640, Height: 480, Orientation: 8, Date: "2001-02-03T04:05:06"},
+		},
+		{
+			name: "no date",
+			data: tiff(
+				uint16(tiffTagImageWidth), uint16(tiffTypeShort), 640,
+				uint16(tiffTagImageLength), uint16(tiffTypeShort), 480,
+				uint16(tiffTagDateTime), uint16(tiffTypeASCII), "0000:00:00 00:00:00",
+			),
+			want: metadata{Width: 640, Height: 480},
+		},
+		{
+			name: "unknown types",
+			data: tiff(
+				uint16(tiffTagImageWidth), uint16(5), 640,
+				uint16(tiffTagOrientation), uint16(tiffTypeASCII), "1",
+			),
+			want: metadata{},
+		},
+		{name: "empty", data: nil, err: io.EOF},
+		{name: "byte order", data: []byte("XX\x2a\x00\x08\x00\x00\x00"), err: errMalformed},
+		{name: "magic", data: []byte("II\x2b\x00\x08\x00\x00\x00"), err: errMalformed},
+		{name: "IFD beyond file", data: []byte("MM\x00\x2a\x00\x00\x10\x00"), err: io.EOF},
+		{name: "truncated IFD", data: []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x02"), err: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			if err := parseTIFF(bytes.NewReader(tt.data), int64(len(tt.data)), &md); err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if md.Width != tt.want.Width || md.Height != tt.want.Height || md.Orientation != tt.want.Orientation || md.Date != tt.want.Date {
+				t.Errorf("got %+v, want %+v", md, tt.want)
+			}
+		})
+	}
+}
+
+func TestExifDate(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{s: "2004:05:06 12:34:56", want: "2004-05-06T12:34:56"},
+		{s: "2004:05:06 12:34:56.789", want: "2004-05-06T12:34:56"},
+		{s: "0000:00:00 00:00:00", want: ""},
+		{s: "2004-05-06 12:34:56", want: ""},
+		{s: "2004:05:06", want: ""},
+		{s: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := exifDate(tt.s); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaLibrary_Item_Orientation(t *testing.T) {
+	m := MediaLibrary{BaseURL: &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"}}
+	r := Root{Path: "/photos"}
+	tests := []struct {
+		orientation int
+		want        string
+	}{
+		{orientation: 0, want: "640x480"},
+		{orientation: 1, want: "640x480"},
+		{orientation: 4, want: "640x480"},
+		{orientation: 5, want: "480x640"},
+		{orientation: 6, want: "480x640"},
+		{orientation: 8, want: "480x640"},
+	}
+	for _, tt := range tests {
+		e := entry{MIME: "image/jpeg", Meta: metadata{Width: 640, Height: 480, Orientation: tt.orientation}}
+		i := m.item(&r, "a.jpg", &e, "0")
+		if i.Resolution != tt.want || i.Orientation != tt.orientation {
+			t.Errorf("orientation %d: got %s, want %s", tt.orientation, i.Resolution, tt.want)
+		}
+		// It's exposed in the DIDL-Lite if known.
+		didl := html.UnescapeString(MediaItems{i}.String())
+		if got, want := strings.Contains(didl, fmt.Sprintf("<cast:orientation>%d</cast:orientation>", tt.orientation)), tt.orientation != 0; got != want {
+			t.Errorf("orientation %d: got %s", tt.orientation, didl)
+		}
+	}
+}
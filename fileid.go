@@ -0,0 +1,21 @@
+//go:build !windows
+
+package cast
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID identifies a file by its device and inode.
+type fileID struct {
+	dev, ino uint64
+}
+
+func identify(_ string, fi fs.FileInfo) (fileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
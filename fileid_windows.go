@@ -0,0 +1,21 @@
+//go:build windows
+
+package cast
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// fileID identifies a file by its path with symlinks resolved since there's no inode on Windows.
+type fileID struct {
+	path string
+}
+
+func identify(p string, _ fs.FileInfo) (fileID, bool) {
+	p, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return fileID{}, false
+	}
+	return fileID{path: p}, true
+}
@@ -0,0 +1,163 @@
+package cast
+
+// h264NALSPS is the NAL unit type of sequence parameter sets.
+const h264NALSPS = 7
+
+// h264HighProfiles are the profile_idc of the profiles whose SPS has the chroma format and the scaling matrices.
+var h264HighProfiles = map[byte]bool{
+	100: true, 110: true, 122: true, 244: true, 44: true, 83: true, 86: true, 118: true, 128: true, 138: true, 139: true, 134: true, 135: true,
+}
+
+// parseSPS reads the profile and the resolution from the H.264 sequence parameter set b, which starts with the NAL header.
+func parseSPS(b []byte, md *metadata) error {
+	if len(b) < 4 || b[0]&0x1f != h264NALSPS {
+		return errMalformed
+	}
+	profile := b[1]
+	r := bitReader{b: unescapeRBSP(b[4:])}
+
+	r.ue() // seq_parameter_set_id
+	chroma := uint32(1)
+	if h264HighProfiles[profile] {
+		chroma = r.ue()
+		if chroma == 3 {
+			r.bits(1) // separate_colour_plane_flag
+		}
+		r.ue()    // bit_depth_luma_minus8
+		r.ue()    // bit_depth_chroma_minus8
+		r.bits(1) // qpprime_y_zero_transform_bypass_flag
+		if r.bits(1) == 1 {
+			n := 8
+			if chroma == 3 {
+				n = 12
+			}
+			for i := 0; i < n; i++ {
+				if r.bits(1) == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				// Skip the scaling list, which ends when the next scale becomes 0.
+				last, next := int32(8), int32(8)
+				for j := 0; j < size && next != 0; j++ {
+					next = (last + r.se() + 256) % 256
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+	r.ue() // log2_max_frame_num_minus4
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bits(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+		for n := r.ue(); n > 0 && r.err == nil; n-- {
+			r.se() // offset_for_ref_frame
+		}
+	}
+	r.ue()    // max_num_ref_frames
+	r.bits(1) // gaps_in_frame_num_value_allowed_flag
+	widthMBs := r.ue() + 1
+	heightMapUnits := r.ue() + 1
+	frameMBsOnly := r.bits(1)
+	if frameMBsOnly == 0 {
+		r.bits(1) // mb_adaptive_frame_field_flag
+	}
+	r.bits(1) // direct_8x8_inference_flag
+	var left, right, top, bottom uint32
+	if r.bits(1) == 1 {
+		left, right, top, bottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if widthMBs > 1<<12 || heightMapUnits > 1<<12 {
+		return errMalformed
+	}
+
+	// The cropping is in units of 2 pixels for 4:2:0 and 4:2:2, and of 2 lines for 4:2:0 and for fields.
+	cropX, cropY := uint32(1), 2-frameMBsOnly
+	if chroma == 1 || chroma == 2 {
+		cropX = 2
+	}
+	if chroma == 1 {
+		cropY *= 2
+	}
+	width := int(widthMBs*16) - int((left+right)*cropX)
+	height := int((2-frameMBsOnly)*heightMapUnits*16) - int((top+bottom)*cropY)
+	if width <= 0 || height <= 0 {
+		return errMalformed
+	}
+	md.VideoProfile = int(profile)
+	md.Width, md.Height = width, height
+	return nil
+}
+
+// unescapeRBSP removes the emulation prevention bytes, 0x03 in 0x000003, from a NAL unit.
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// bitReader reads bits and Exp-Golomb codes from b, MSB first. It reads zeros and sets err after the end of b.
+type bitReader struct {
+	b   []byte
+	n   int
+	err error
+}
+
+// bits reads n bits, up to 32.
+func (r *bitReader) bits(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.n >= 8*len(r.b) {
+			r.err = errMalformed
+			return 0
+		}
+		v = v<<1 | uint32(r.b[r.n/8]>>(7-r.n%8)&1)
+		r.n++
+	}
+	return v
+}
+
+// ue reads an unsigned Exp-Golomb code.
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.bits(1) == 0 {
+		if r.err != nil || zeros == 31 {
+			r.err = errMalformed
+			return 0
+		}
+		zeros++
+	}
+	return 1<<zeros - 1 + r.bits(zeros)
+}
+
+// se reads a signed Exp-Golomb code.
+func (r *bitReader) se() int32 {
+	v := r.ue()
+	if v&1 == 1 {
+		return int32(v/2) + 1
+	}
+	return -int32(v / 2)
+}
@@ -0,0 +1,57 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseSPS(t *testing.T) {
+	tests := []struct {
+		name          string
+		sps           string
+		profile       int
+		width, height int
+		err           error
+	}{
+		{name: "main 720p", sps: "674d401fed00a00b72", profile: avcProfileMain, width: 1280, height: 720},
+		// It has scaling matrices, the picture order count type 1 and the cropping from 1088 lines.
+		{name: "high 1080p", sps: "67640028ad8401080a14cd3280f0044fca80", profile: avcProfileHigh, width: 1920, height: 1080},
+		{name: "main 576i", sps: "674d401eed01684990", profile: avcProfileMain, width: 720, height: 576},
+		{name: "not SPS", sps: "684d401fed00a00b72", err: errMalformed},
+		{name: "empty", sps: "", err: errMalformed},
+		{name: "truncated", sps: "674d401fed00", err: errMalformed},
+		{name: "no ones", sps: "674d401f0000000000000000", err: errMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := hex.DecodeString(tt.sps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var md metadata
+			if err := parseSPS(b, &md); err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if md.VideoProfile != tt.profile || md.Width != tt.width || md.Height != tt.height {
+				t.Errorf("got %d %dx%d, want %d %dx%d", md.VideoProfile, md.Width, md.Height, tt.profile, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestUnescapeRBSP(t *testing.T) {
+	tests := []struct {
+		b, want []byte
+	}{
+		{b: []byte{1, 2, 3}, want: []byte{1, 2, 3}},
+		{b: []byte{0, 0, 3, 1}, want: []byte{0, 0, 1}},
+		{b: []byte{0, 0, 3, 0, 0, 3}, want: []byte{0, 0, 0, 0}},
+		{b: []byte{0, 3, 0, 3}, want: []byte{0, 3, 0, 3}},
+	}
+	for _, tt := range tests {
+		if got := unescapeRBSP(tt.b); !bytes.Equal(got, tt.want) {
+			t.Errorf("unescapeRBSP(%v): got %v, want %v", tt.b, got, tt.want)
+		}
+	}
+}
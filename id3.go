@@ -0,0 +1,361 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// parseID3 reads the tags of an MP3 file from its ID3v2 tag, falling back to its ID3v1 tag for missing ones.
+func parseID3(r io.ReaderAt, size int64, md *metadata) error {
+	if err := parseID3v2(r, size, md); err != nil && err != errMalformed {
+		return err
+	}
+	return parseID3v1(r, size, md)
+}
+
+const (
+	// id3TextLimit is the maximum number of bytes read from a text frame.
+	id3TextLimit = 64 << 10
+	// id3PictureHeaderLimit is the maximum number of bytes read from an attached picture frame to locate the image in it.
+	id3PictureHeaderLimit = 4 << 10
+	// id3UnsyncLimit is the maximum number of bytes read from an unsynchronised tag, which is decoded in memory.
+	id3UnsyncLimit = 1 << 20
+)
+
+// parseID3v2 reads the ID3v2 tag at the head of the file of size bytes frame by frame.
+// Only the heads of the frames are read so that large pictures are located without being loaded.
+func parseID3v2(r io.ReaderAt, size int64, md *metadata) error {
+	var h [10]byte
+	if _, err := r.ReadAt(h[:], 0); err != nil {
+		return err
+	}
+	if string(h[:3]) != "ID3" {
+		return errMalformed
+	}
+	var (
+		version = h[3]
+		flags   = h[5]
+		end     = int64(syncsafe(h[6:10]))
+	)
+	if version < 2 || version > 4 || 10+end > size {
+		return errMalformed
+	}
+
+	// Frames are read at their offsets in the tag.
+	var tag io.ReaderAt = io.NewSectionReader(r, 10, end)
+	// Pictures are located by their offsets in the file, which are lost by unsynchronisation.
+	unsync := flags&0x80 != 0
+	if unsync {
+		n := end
+		if n > id3UnsyncLimit {
+			n = id3UnsyncLimit
+		}
+		b := make([]byte, n)
+		if _, err := r.ReadAt(b, 10); err != nil {
+			return err
+		}
+		b = bytes.ReplaceAll(b, []byte{0xff, 0x00}, []byte{0xff})
+		tag, end = bytes.NewReader(b), int64(len(b))
+	}
+	read := func(offset, n, limit int64) ([]byte, error) {
+		if n > limit {
+			n = limit
+		}
+		b := make([]byte, n)
+		_, err := tag.ReadAt(b, offset)
+		return b, err
+	}
+
+	var offset int64
+	if flags&0x40 != 0 && version > 2 && end >= 4 {
+		b, err := read(0, 4, 4)
+		if err != nil {
+			return err
+		}
+		n := int64(binary.BigEndian.Uint32(b)) + 4
+		if version == 4 {
+			n = int64(syncsafe(b))
+		}
+		if n > end {
+			return errMalformed
+		}
+		offset = n
+	}
+
+	hsize := int64(10)
+	if version == 2 {
+		hsize = 6
+	}
+	for offset+hsize <= end {
+		b, err := read(offset, hsize, hsize)
+		if err != nil {
+			return err
+		}
+		if b[0] == 0 {
+			break
+		}
+		var (
+			id string
+			n  int64
+			// plain tells if the frame is neither compressed, encrypted nor unsynchronised.
+			plain = !unsync
+		)
+		switch version {
+		case 2:
+			id, n = string(b[:3]), int64(b[3])<<16|int64(b[4])<<8|int64(b[5])
+		case 3:
+			id, n = string(b[:4]), int64(binary.BigEndian.Uint32(b[4:8]))
+			plain = plain && b[9]&0xc0 == 0
+		case 4:
+			id, n = string(b[:4]), int64(syncsafe(b[4:8]))
+			plain = plain && b[9]&0x0e == 0
+		}
+		if n > end-offset-hsize {
+			return errMalformed
+		}
+		dataOffset := offset + hsize
+		offset = dataOffset + n
+
+		switch {
+		case id[0] == 'T':
+			data, err := read(dataOffset, n, id3TextLimit)
+			if err != nil {
+				return err
+			}
+			switch id {
+			case "TIT2", "TT2":
+				md.Title = id3Text(data)
+			case "TPE1", "TP1":
+				md.Artist = id3Text(data)
+			case "TPE2", "TP2":
+				md.AlbumArtist = id3Text(data)
+			case "TALB", "TAL":
+				md.Album = id3Text(data)
+			case "TCON", "TCO":
+				md.Genre = id3Genre(id3Text(data))
+			case "TRCK", "TRK":
+				md.Track = trackNumber(id3Text(data))
+			case "TDRC", "TYER", "TYE":
+				if md.Date == "" || id == "TDRC" {
+					md.Date = normalizeDate(id3Text(data))
+				}
+			}
+		case id == "APIC" || id == "PIC":
+			if !plain {
+				break
+			}
+			data, err := read(dataOffset, n, id3PictureHeaderLimit)
+			if err != nil {
+				return err
+			}
+			typ, k, ok := id3Picture(data, version)
+			if !ok {
+				break
+			}
+			if t := imageType(data[k:]); t != "" && md.Picture.prefer(uint32(typ)) {
+				md.Picture = picture{Offset: 10 + dataOffset + int64(k), Size: n - int64(k), MIME: t, Front: typ == frontCover}
+			}
+		}
+	}
+	return nil
+}
+
+// id3Picture returns the picture type and the offset of the image data in an attached picture frame.
+func id3Picture(data []byte, version byte) (byte, int, bool) {
+	if len(data) < 1 {
+		return 0, 0, false
+	}
+	enc, i := data[0], 1
+	if version == 2 {
+		// Image format, e.g. JPG.
+		i += 3
+	} else {
+		n := bytes.IndexByte(data[i:], 0)
+		if n < 0 {
+			return 0, 0, false
+		}
+		i += n + 1
+	}
+	if i >= len(data) {
+		return 0, 0, false
+	}
+	typ := data[i]
+	i++
+
+	// The description is terminated by a null character, which is 2 bytes long in UTF-16.
+	if enc == 1 || enc == 2 {
+		for ; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return typ, i + 2, true
+			}
+		}
+		return 0, 0, false
+	}
+	n := bytes.IndexByte(data[i:], 0)
+	if n < 0 {
+		return 0, 0, false
+	}
+	return typ, i + n + 1, true
+}
+
+func parseID3v1(r io.ReaderAt, size int64, md *metadata) error {
+	if size < 128 {
+		return nil
+	}
+	var b [128]byte
+	if _, err := r.ReadAt(b[:], size-128); err != nil {
+		return err
+	}
+	if string(b[:3]) != "TAG" {
+		return nil
+	}
+
+	text := func(b []byte) string {
+		return strings.TrimSpace(latin1(bytes.TrimRight(b, "\x00")))
+	}
+	if md.Title == "" {
+		md.Title = text(b[3:33])
+	}
+	if md.Artist == "" {
+		md.Artist = text(b[33:63])
+	}
+	if md.Album == "" {
+		md.Album = text(b[63:93])
+	}
+	if md.Date == "" {
+		md.Date = normalizeDate(text(b[93:97]))
+	}
+	if md.Track == 0 && b[125] == 0 {
+		md.Track = int(b[126])
+	}
+	if md.Genre == "" && int(b[127]) < len(id3Genres) {
+		md.Genre = id3Genres[b[127]]
+	}
+	return nil
+}
+
+// syncsafe decodes a 28-bit integer stored in 4 bytes with the most significant bits unset.
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// id3Text decodes the first string of a text information frame.
+func id3Text(data []byte) string {
+	if len(data) < 1 {
+		return ""
+	}
+	enc, data := data[0], data[1:]
+	var s string
+	switch enc {
+	case 0:
+		s = latin1(data)
+	case 1, 2:
+		s = decodeUTF16(data, enc == 2)
+	default:
+		s = string(data)
+	}
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+func latin1(b []byte) string {
+	rs := make([]rune, len(b))
+	for i, c := range b {
+		rs[i] = rune(c)
+	}
+	return string(rs)
+}
+
+// decodeUTF16 decodes UTF-16 text which starts with a byte order mark unless bigEndian is set.
+func decodeUTF16(b []byte, bigEndian bool) string {
+	var order binary.ByteOrder = binary.BigEndian
+	if !bigEndian && len(b) >= 2 {
+		switch {
+		case b[0] == 0xff && b[1] == 0xfe:
+			order, b = binary.LittleEndian, b[2:]
+		case b[0] == 0xfe && b[1] == 0xff:
+			b = b[2:]
+		}
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, order.Uint16(b[i:]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// id3Genre resolves references to ID3v1 genres such as "(17)" or "17" in a content type frame.
+func id3Genre(s string) string {
+	ref := s
+	if strings.HasPrefix(s, "(") {
+		i := strings.Index(s, ")")
+		if i < 0 {
+			return s
+		}
+		if rest := strings.TrimSpace(s[i+1:]); rest != "" {
+			return rest
+		}
+		ref = s[1:i]
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 0 && n < len(id3Genres) {
+		return id3Genres[n]
+	}
+	return s
+}
+
+// trackNumber parses a track number which may be followed by the total number of tracks, e.g. "3/12".
+func trackNumber(s string) int {
+	if i := strings.Index(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+// normalizeDate converts dates in tags, e.g. "2004" or "2004-05-06T12:00", into the form of YYYY-MM-DD.
+func normalizeDate(s string) string {
+	s = strings.TrimSpace(s)
+	switch {
+	case len(s) >= 10 && s[4] == '-' && s[7] == '-':
+		s = s[:10]
+	case len(s) >= 7 && s[4] == '-':
+		s = s[:7] + "-01"
+	case len(s) >= 4:
+		s = s[:4] + "-01-01"
+	default:
+		return ""
+	}
+	if _, err := strconv.Atoi(s[:4]); err != nil {
+		return ""
+	}
+	return s
+}
+
+// id3Genres are the genres defined in ID3v1 and its Winamp extensions.
+var id3Genres = [...]string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap",
+	"Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska", "Death Metal", "Pranks",
+	"Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance",
+	"Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychedelic", "Rave", "Showtunes", "Trailer", "Lo-Fi",
+	"Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebop", "Latin", "Revival",
+	"Celtic", "Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock", "Slow Rock",
+	"Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour", "Speech", "Chanson", "Opera",
+	"Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam",
+	"Club", "Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle",
+	"Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House", "Dance Hall", "Goa", "Drum & Bass",
+	"Club-House", "Hardcore Techno", "Terror", "Indie", "BritPop", "Negerpunk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover", "Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "Jpop", "Synthpop",
+}
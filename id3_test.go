@@ -0,0 +1,259 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+)
+
+// id3v2 returns an ID3v2 tag of the version with the flags and the frames.
+func id3v2(version, flags byte, frames ...[]byte) []byte {
+	b := bytes.Join(frames, nil)
+	n := len(b)
+	return append([]byte{'I', 'D', '3', version, 0, flags, byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}, b...)
+}
+
+// id3Frame returns a frame of the ID3v2 version with the data.
+func id3Frame(version byte, id string, data string) []byte {
+	n := len(data)
+	switch version {
+	case 2:
+		return append([]byte{id[0], id[1], id[2], byte(n >> 16), byte(n >> 8), byte(n)}, data...)
+	case 3:
+		var h [10]byte
+		copy(h[:], id)
+		binary.BigEndian.PutUint32(h[4:], uint32(n))
+		return append(h[:], data...)
+	default:
+		return append([]byte{id[0], id[1], id[2], id[3], byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f), 0, 0}, data...)
+	}
+}
+
+func TestParseID3(t *testing.T) {
+	b, err := os.ReadFile("testdata/tags.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var md metadata
+	if err := parseID3(bytes.NewReader(b), int64(len(b)), &md); err != nil {
+		t.Fatal(err)
+	}
+	// The ID3v1 tag provides only the date missing in the ID3v2 tag.
+	want := metadata{
+		Title:       "Title ✓",
+		Artist:      "Artist",
+		AlbumArtist: "Album Artist",
+		Album:       "Album é",
+		Genre:       "Rock",
+		Track:       3,
+		Date:        "1999-01-01",
+	}
+	if md.Title != want.Title || md.Artist != want.Artist || md.AlbumArtist != want.AlbumArtist ||
+		md.Album != want.Album || md.Genre != want.Genre || md.Track != want.Track || md.Date != want.Date {
+		t.Errorf("got %+v, want %+v", md, want)
+	}
+	// The front cover is preferred to the back cover before it.
+	if want := (picture{Offset: 966, Size: 73, MIME: "image/png", Front: true}); md.Picture != want {
+		t.Errorf("got %+v, want %+v", md.Picture, want)
+	}
+	if got := b[md.Picture.Offset : md.Picture.Offset+4]; string(got) != "\x89PNG" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestParseID3v2(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n"
+	tests := []struct {
+		name    string
+		tag     []byte
+		want    metadata
+		picture picture
+		err     error
+	}{
+		{
+			name: "ID3v2.2",
+			tag: id3v2(2, 0,
+				id3Frame(2, "TT2", "\x00Title"),
+				id3Frame(2, "TP1", "\x00Artist"),
+				id3Frame(2, "TYE", "\x002001"),
+				id3Frame(2, "PIC", "\x00PNG\x03\x00"+png),
+			),
+			want: metadata{Title: "Title", Artist: "Artist", Date: "2001-01-01"},
+			// The image follows the tag header, 3 frames, the frame header and the encoding, format, type and description.
+			picture: picture{Offset: 10 + 12 + 13 + 11 + 6 + 6, Size: 8, MIME: "image/png", Front: true},
+		},
+		{
+			name: "ID3v2.4",
+			tag: id3v2(4, 0,
+				id3Frame(4, "TYER", "\x002001"),
+				id3Frame(4, "TDRC", "\x032002-03-04T05:06"),
+				id3Frame(4, "TCON", "\x03(17)Indie Rock"),
+				id3Frame(4, "TRCK", "\x03 7 "),
+			),
+			want: metadata{Genre: "Indie Rock", Track: 7, Date: "2002-03-04"},
+		},
+		{
+			name: "extended header",
+			tag: id3v2(3, 0x40,
+				[]byte{0, 0, 0, 6, 0, 0, 0, 0, 0, 0},
+				id3Frame(3, "TALB", "\x00Album"),
+			),
+			want: metadata{Album: "Album"},
+		},
+		{
+			name: "unsynchronisation",
+			tag: id3v2(3, 0x80, bytes.ReplaceAll(bytes.Join([][]byte{
+				id3Frame(3, "TIT2", "\x00\xffTitle"),
+				id3Frame(3, "APIC", "\x00image/png\x00\x03\x00"+png),
+			}, nil), []byte{0xff}, []byte{0xff, 0x00})),
+			// The offsets of pictures are lost.
+			want: metadata{Title: "ÿTitle"},
+		},
+		{
+			name: "padding",
+			tag:  id3v2(3, 0, id3Frame(3, "TIT2", "\x00Title"), make([]byte, 100)),
+			want: metadata{Title: "Title"},
+		},
+		{name: "tag larger than file", tag: id3v2(3, 0, id3Frame(3, "TIT2", "\x00Title"))[:20], err: errMalformed},
+		{name: "frame larger than tag", tag: id3v2(3, 0, id3Frame(3, "TIT2", "\x00Title")[:12]), err: errMalformed},
+		{name: "unknown version", tag: id3v2(5, 0, id3Frame(4, "TIT2", "\x00Title")), err: errMalformed},
+		{name: "not ID3", tag: []byte("RIFF\x00\x00\x00\x00WAVE"), err: errMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			if err := parseID3v2(bytes.NewReader(tt.tag), int64(len(tt.tag)), &md); err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if md.Title != tt.want.Title || md.Artist != tt.want.Artist || md.Album != tt.want.Album ||
+				md.Genre != tt.want.Genre || md.Track != tt.want.Track || md.Date != tt.want.Date {
+				t.Errorf("got %+v, want %+v", md, tt.want)
+			}
+			if md.Picture != tt.picture {
+				t.Errorf("got %+v, want %+v", md.Picture, tt.picture)
+			}
+		})
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.ReaderAt
+	n int
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n += n
+	return n, err
+}
+
+func TestParseID3v2_LargePicture(t *testing.T) {
+	image := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 16<<20)...)
+	tag := id3v2(4, 0,
+		id3Frame(4, "APIC", "\x00image/png\x00\x03\x00"+string(image)),
+		id3Frame(4, "TIT2", "\x00Title"),
+	)
+	r := countingReader{r: bytes.NewReader(tag)}
+	var md metadata
+	if err := parseID3v2(&r, int64(len(tag)), &md); err != nil {
+		t.Fatal(err)
+	}
+	if want := (picture{Offset: 10 + 10 + 13, Size: int64(len(image)), MIME: "image/png", Front: true}); md.Picture != want || md.Title != "Title" {
+		t.Errorf("got %+v", md)
+	}
+	// The image itself isn't read.
+	if r.n > 64<<10 {
+		t.Errorf("read %d bytes", r.n)
+	}
+}
+
+func TestID3Text(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "empty", data: "", want: ""},
+		{name: "Latin-1", data: "\x00Caf\xe9", want: "Café"},
+		{name: "UTF-16 little endian", data: "\x01\xff\xfeC\x00a\x00f\x00\xe9\x00", want: "Café"},
+		{name: "UTF-16 big endian with BOM", data: "\x01\xfe\xff\x00C\x00a\x00f\x00\xe9", want: "Café"},
+		{name: "UTF-16BE", data: "\x02\x00C\x00a\x00f\x00\xe9", want: "Café"},
+		{name: "UTF-8", data: "\x03Caf\xc3\xa9", want: "Café"},
+		{name: "first of multiple strings", data: "\x03Rock\x00Pop", want: "Rock"},
+		{name: "surrounding spaces", data: "\x00 Title \x00", want: "Title"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := id3Text([]byte(tt.data)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestID3Genre(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "(17)", want: "Rock"},
+		{s: "17", want: "Rock"},
+		{s: "(17)Indie Rock", want: "Indie Rock"},
+		{s: "(999)", want: "(999)"},
+		{s: "(17", want: "(17"},
+		{s: "Jazz", want: "Jazz"},
+		{s: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := id3Genre(tt.s); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackNumber(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{s: "3", want: 3},
+		{s: "03/12", want: 3},
+		{s: " 3 / 12", want: 3},
+		{s: "/12", want: 0},
+		{s: "A1", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := trackNumber(tt.s); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDate(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "2004", want: "2004-01-01"},
+		{s: "2004-05", want: "2004-05-01"},
+		{s: "2004-05-06", want: "2004-05-06"},
+		{s: "2004-05-06T12:00:00Z", want: "2004-05-06"},
+		{s: " 2004 ", want: "2004-01-01"},
+		{s: "04", want: ""},
+		{s: "unknown", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := normalizeDate(tt.s); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package cast
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ignoreFile is the name of the files which list gitignore-style patterns of paths to exclude from the library.
+// The patterns in an ignore file apply to the directory containing it and its subdirectories.
+const ignoreFile = ".castignore"
+
+// ignoreRule is a gitignore-style pattern.
+type ignoreRule struct {
+	// base is the slash-separated directory relative to the root which the pattern is relative to.
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules is a list of ignore rules in order of precedence. Later rules override earlier ones.
+type ignoreRules []ignoreRule
+
+// parseIgnoreRule parses a line of an ignore file.
+// It returns false if the line is blank or a comment.
+func parseIgnoreRule(base, line string) (ignoreRule, bool, error) {
+	r := ignoreRule{base: base}
+
+	line = strings.TrimRight(line, " \t\r")
+	if strings.HasSuffix(line, "\\") {
+		line += " "
+	}
+	switch {
+	case line == "", strings.HasPrefix(line, "#"):
+		return r, false, nil
+	case strings.HasPrefix(line, "!"):
+		r.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, "\\#"), strings.HasPrefix(line, "\\!"):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return r, false, nil
+	}
+
+	var b strings.Builder
+	if strings.Contains(line, "/") {
+		line = strings.TrimPrefix(line, "/")
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; c {
+		case '*':
+			if !strings.HasPrefix(line[i:], "**") {
+				b.WriteString("[^/]*")
+				continue
+			}
+			i++
+			switch {
+			case strings.HasPrefix(line[i+1:], "/"):
+				b.WriteString("(?:.*/)?")
+				i++
+			case i+1 == len(line):
+				b.WriteString(".*")
+			default:
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := strings.Index(line[i+1:], "]")
+			if j < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := line[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += j + 1
+		case '\\':
+			if i+1 < len(line) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(line[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return r, false, fmt.Errorf("invalid pattern: %s", line)
+	}
+	r.re = re
+	return r, true, nil
+}
+
+// parseIgnoreRules parses patterns relative to base.
+func parseIgnoreRules(base string, patterns []string) (ignoreRules, error) {
+	var rs ignoreRules
+	for _, p := range patterns {
+		r, ok, err := parseIgnoreRule(base, p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rs = append(rs, r)
+		}
+	}
+	return rs, nil
+}
+
+// readIgnoreFile reads the ignore file in dir, if any, whose slash-separated path relative to the root is base.
+func readIgnoreFile(dir, base string) ignoreRules {
+	p := filepath.Join(dir, ignoreFile)
+	f, err := os.Open(p)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.WithField("path", p).WithError(err).Warn("Failed to open ignore file.")
+		}
+		return nil
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var rs ignoreRules
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		r, ok, err := parseIgnoreRule(base, s.Text())
+		if err != nil {
+			log.WithField("path", p).WithError(err).Warn("Skip invalid pattern.")
+			continue
+		}
+		if ok {
+			rs = append(rs, r)
+		}
+	}
+	if err := s.Err(); err != nil {
+		log.WithField("path", p).WithError(err).Warn("Failed to read ignore file.")
+	}
+	return rs
+}
+
+// with returns the rules followed by the rules in the ignore file of dir.
+func (rs ignoreRules) with(dir, base string) ignoreRules {
+	own := readIgnoreFile(dir, base)
+	if len(own) == 0 {
+		return rs
+	}
+	return append(rs[:len(rs):len(rs)], own...)
+}
+
+// match tells if the slash-separated path relative to the root is ignored.
+func (rs ignoreRules) match(rel string, dir bool) bool {
+	var ignored bool
+	for _, r := range rs {
+		if r.dirOnly && !dir {
+			continue
+		}
+		sub := rel
+		if r.base != "." {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			sub = strings.TrimPrefix(rel, r.base+"/")
+		}
+		if r.re.MatchString(sub) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// ignoreRules returns the rules which apply to the children of the slash-separated directory relative to the root.
+func (m *MediaLibrary) ignoreRules(r *Root, rel string) ignoreRules {
+	rs := m.ignore.with(r.Path, ".")
+	if rel == "." {
+		return rs
+	}
+	var base string
+	for _, name := range strings.Split(rel, "/") {
+		base = path.Join(base, name)
+		rs = rs.with(filepath.Join(r.Path, filepath.FromSlash(base)), base)
+	}
+	return rs
+}
+
+// ignored tells if the slash-separated path relative to the root is excluded from the library by rs.
+func (m *MediaLibrary) ignored(rs ignoreRules, rel string, dir bool) bool {
+	if rel == "." {
+		return false
+	}
+	if !m.Hidden && strings.HasPrefix(path.Base(rel), ".") {
+		return true
+	}
+	return rs.match(rel, dir)
+}
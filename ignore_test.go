@@ -0,0 +1,111 @@
+package cast
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		rel      string
+		dir      bool
+		want     bool
+	}{
+		{name: "base name", patterns: []string{"*.nfo"}, rel: "movie.nfo", want: true},
+		{name: "base name in subdirectory", patterns: []string{"*.nfo"}, rel: "a/b/movie.nfo", want: true},
+		{name: "other extension", patterns: []string{"*.nfo"}, rel: "a/movie.mkv", want: false},
+		{name: "star doesn't match slash", patterns: []string{"a/*.nfo"}, rel: "a/b/movie.nfo", want: false},
+		{name: "anchored", patterns: []string{"/extras"}, rel: "extras", dir: true, want: true},
+		{name: "anchored in subdirectory", patterns: []string{"/extras"}, rel: "a/extras", dir: true, want: false},
+		{name: "with slash is anchored", patterns: []string{"a/extras"}, rel: "b/a/extras", dir: true, want: false},
+		{name: "directory only", patterns: []string{"samples/"}, rel: "a/samples", dir: true, want: true},
+		{name: "directory only on file", patterns: []string{"samples/"}, rel: "a/samples", want: false},
+		{name: "leading double star", patterns: []string{"**/trailers"}, rel: "a/b/trailers", dir: true, want: true},
+		{name: "leading double star at top", patterns: []string{"**/trailers"}, rel: "trailers", dir: true, want: true},
+		{name: "middle double star", patterns: []string{"a/**/b.mkv"}, rel: "a/x/y/b.mkv", want: true},
+		{name: "middle double star matches none", patterns: []string{"a/**/b.mkv"}, rel: "a/b.mkv", want: true},
+		{name: "trailing double star", patterns: []string{"a/**"}, rel: "a/x/y.mkv", want: true},
+		{name: "trailing double star not itself", patterns: []string{"a/**"}, rel: "a", dir: true, want: false},
+		{name: "question mark", patterns: []string{"disc?.iso"}, rel: "disc1.iso", want: true},
+		{name: "question mark doesn't match slash", patterns: []string{"a?b"}, rel: "a/b", want: false},
+		{name: "class", patterns: []string{"cd[12].mkv"}, rel: "cd2.mkv", want: true},
+		{name: "class not matched", patterns: []string{"cd[12].mkv"}, rel: "cd3.mkv", want: false},
+		{name: "negated class", patterns: []string{"cd[!12].mkv"}, rel: "cd3.mkv", want: true},
+		{name: "unclosed bracket", patterns: []string{"a[b"}, rel: "a[b", want: true},
+		{name: "negation", patterns: []string{"*.mkv", "!keep.mkv"}, rel: "keep.mkv", want: false},
+		{name: "negation overridden", patterns: []string{"!keep.mkv", "*.mkv"}, rel: "keep.mkv", want: true},
+		{name: "comment", patterns: []string{"# *.mkv"}, rel: "a.mkv", want: false},
+		{name: "escaped hash", patterns: []string{`\#a.mkv`}, rel: "#a.mkv", want: true},
+		{name: "escaped bang", patterns: []string{`\!a.mkv`}, rel: "!a.mkv", want: true},
+		{name: "trailing spaces", patterns: []string{"a.mkv  "}, rel: "a.mkv", want: true},
+		{name: "escaped trailing space", patterns: []string{`a.mkv\ `}, rel: "a.mkv ", want: true},
+		{name: "regexp metacharacters", patterns: []string{"a+(1).mkv"}, rel: "a+(1).mkv", want: true},
+		{name: "blank", patterns: []string{"", "  "}, rel: "a.mkv", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := parseIgnoreRules(".", tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rs.match(tt.rel, tt.dir); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaLibrary_IgnoreRules(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		ignoreFile:                     "*.nfo\n/private/\n",
+		filepath.Join("a", ignoreFile): "!keep.nfo\nb.mkv\n",
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ignore, err := parseIgnoreRules(".", []string{"*.txt", "!readme.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := MediaLibrary{ignore: ignore}
+	r := Root{Path: dir}
+	tests := []struct {
+		parent, rel string
+		dir         bool
+		hidden      bool
+		want        bool
+	}{
+		{parent: ".", rel: "a.nfo", want: true},
+		{parent: ".", rel: "a.txt", want: true},
+		{parent: ".", rel: "readme.txt", want: false},
+		{parent: ".", rel: "private", dir: true, want: true},
+		{parent: ".", rel: "b.mkv", want: false},
+		{parent: ".", rel: ".hidden", want: true},
+		{parent: ".", rel: ".hidden", hidden: true, want: false},
+		{parent: ".", rel: ".", dir: true, want: false},
+		// The ignore file of a applies only to a and its subdirectories, and overrides the others.
+		{parent: "a", rel: "a/keep.nfo", want: false},
+		{parent: "a", rel: "a/other.nfo", want: true},
+		{parent: "a", rel: "a/b.mkv", want: true},
+		{parent: "a/c", rel: "a/c/b.mkv", want: true},
+		{parent: "a", rel: "a/private", dir: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			m.Hidden = tt.hidden
+			if got := m.ignored(m.ignoreRules(&r, tt.parent), tt.rel, tt.dir); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
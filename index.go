@@ -0,0 +1,99 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// indexVersion must be incremented whenever entry changes so that indexes written by older versions are discarded.
+const indexVersion = 13
+
+type index struct {
+	Version int
+	Entries map[string]*entry
+}
+
+// loadIndex reads the entries persisted at m.IndexPath.
+// It returns nil if there's no usable index.
+func (m *MediaLibrary) loadIndex() map[string]*entry {
+	if m.IndexPath == "" {
+		return nil
+	}
+
+	f, err := os.Open(m.IndexPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.WithField("path", m.IndexPath).WithError(err).Warn("Failed to open index.")
+		}
+		return nil
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var idx index
+	if err := gob.NewDecoder(f).Decode(&idx); err != nil {
+		log.WithField("path", m.IndexPath).WithError(err).Warn("Failed to decode index.")
+		return nil
+	}
+	if idx.Version != indexVersion {
+		log.WithField("path", m.IndexPath).Info("Discard outdated index.")
+		return nil
+	}
+	return idx.Entries
+}
+
+// saveIndex persists the current entries at m.IndexPath.
+// Entries that are no longer in the library aren't persisted.
+// It must be called with m.mu locked.
+func (m *MediaLibrary) saveIndex() {
+	if m.IndexPath == "" {
+		return
+	}
+
+	if err := writeIndex(m.IndexPath, &index{
+		Version: indexVersion,
+		Entries: m.entries,
+	}); err != nil {
+		log.WithField("path", m.IndexPath).WithError(err).Warn("Failed to save index.")
+	}
+}
+
+// writeIndex writes idx to path with writeFile so that a crash never leaves a broken index.
+func writeIndex(path string, idx *index) error {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(idx); err != nil {
+		return err
+	}
+	return writeFile(path, b.Bytes())
+}
+
+// writeFile writes b to a temporary file and renames it to path so that readers never see a partially written file.
+func writeFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
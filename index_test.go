@@ -0,0 +1,54 @@
+package cast
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMediaLibrary_Index(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache", "index")
+	modTime := time.Date(2004, 5, 6, 12, 34, 56, 0, time.UTC)
+
+	m := MediaLibrary{
+		IndexPath: path,
+		entries: map[string]*entry{
+			"/music":       {Dir: true},
+			"/music/a.mp3": {Size: 100, ModTime: modTime, MIME: "audio/mpeg", Meta: metadata{Title: "A", Track: 3}},
+		},
+	}
+	// The index is written twice to replace the first one.
+	m.saveIndex()
+	m.saveIndex()
+
+	got := m.loadIndex()
+	if len(got) != 2 || !got["/music"].Dir {
+		t.Fatalf("got %v", got)
+	}
+	if e := got["/music/a.mp3"]; e.Size != 100 || !e.ModTime.Equal(modTime) || e.MIME != "audio/mpeg" || e.Meta.Title != "A" || e.Meta.Track != 3 {
+		t.Errorf("got %+v", e)
+	}
+	// No temporary files are left.
+	fs, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fs) != 1 {
+		t.Errorf("got %d files", len(fs))
+	}
+
+	if err := writeIndex(path, &index{Version: indexVersion - 1, Entries: m.entries}); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.loadIndex(); got != nil {
+		t.Errorf("outdated index loaded: %v", got)
+	}
+	if err := os.WriteFile(path, []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.loadIndex(); got != nil {
+		t.Errorf("broken index loaded: %v", got)
+	}
+}
@@ -0,0 +1,295 @@
+package cast
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// Matroska element IDs.
+const (
+	ebmlIDHeader            = 0x1A45DFA3
+	ebmlIDSegment           = 0x18538067
+	ebmlIDInfo              = 0x1549A966
+	ebmlIDTimecodeScale     = 0x2AD7B1
+	ebmlIDDuration          = 0x4489
+	ebmlIDTracks            = 0x1654AE6B
+	ebmlIDTrackEntry        = 0xAE
+	ebmlIDTrackType         = 0x83
+	ebmlIDCodecID           = 0x86
+	ebmlIDCodecPrivate      = 0x63A2
+	ebmlIDVideo             = 0xE0
+	ebmlIDPixelWidth        = 0xB0
+	ebmlIDPixelHeight       = 0xBA
+	ebmlIDAudio             = 0xE1
+	ebmlIDSamplingFrequency = 0xB5
+	ebmlIDChannels          = 0x9F
+	ebmlIDCluster           = 0x1F43B675
+)
+
+// Matroska track types.
+const (
+	matroskaTrackVideo = 1
+	matroskaTrackAudio = 2
+)
+
+// ebmlElement is an element of an EBML document, e.g. Matroska and WebM.
+type ebmlElement struct {
+	id uint32
+	// offset is the offset of the payload.
+	offset int64
+	// size is the size of the payload. It's -1 if unknown.
+	size int64
+}
+
+// ebmlVarInt reads a variable length integer at offset.
+// If marker is false, the length descriptor bit is cleared from the value.
+func ebmlVarInt(r io.ReaderAt, offset int64, marker bool) (uint64, int, error) {
+	var b [8]byte
+	if _, err := r.ReadAt(b[:1], offset); err != nil {
+		return 0, 0, err
+	}
+	n := bits.LeadingZeros8(b[0]) + 1
+	if n > 8 {
+		return 0, 0, errMalformed
+	}
+	if _, err := r.ReadAt(b[1:n], offset+1); err != nil {
+		return 0, 0, err
+	}
+	var v uint64
+	for _, c := range b[:n] {
+		v = v<<8 | uint64(c)
+	}
+	if !marker {
+		v &^= 1 << (7 * n)
+	}
+	return v, n, nil
+}
+
+// ebmlElements returns the child elements in the payload of the parent until one of the stop IDs.
+func ebmlElements(r io.ReaderAt, parent ebmlElement, stop ...uint32) ([]ebmlElement, error) {
+	var (
+		es     []ebmlElement
+		offset = parent.offset
+		end    = parent.offset + parent.size
+	)
+	for parent.size < 0 || offset < end {
+		id, n, err := ebmlVarInt(r, offset, true)
+		if err != nil {
+			return es, err
+		}
+		for _, s := range stop {
+			if uint32(id) == s {
+				return es, nil
+			}
+		}
+		size, m, err := ebmlVarInt(r, offset+int64(n), false)
+		if err != nil {
+			return es, err
+		}
+		e := ebmlElement{
+			id:     uint32(id),
+			offset: offset + int64(n+m),
+			size:   int64(size),
+		}
+		if size == 1<<(7*m)-1 {
+			e.size = -1
+		}
+		es = append(es, e)
+		if e.size < 0 {
+			return es, nil
+		}
+		offset = e.offset + e.size
+	}
+	return es, nil
+}
+
+func (e ebmlElement) bytes(r io.ReaderAt) ([]byte, error) {
+	if e.size < 0 || e.size > 8 {
+		return nil, errMalformed
+	}
+	b := make([]byte, e.size)
+	_, err := r.ReadAt(b, e.offset)
+	return b, err
+}
+
+// data returns the payload of the element, which is larger than a number, up to limit bytes.
+func (e ebmlElement) data(r io.ReaderAt, limit int64) ([]byte, error) {
+	if e.size < 0 {
+		return nil, errMalformed
+	}
+	n := e.size
+	if n > limit {
+		n = limit
+	}
+	b := make([]byte, n)
+	_, err := r.ReadAt(b, e.offset)
+	return b, err
+}
+
+func (e ebmlElement) uint(r io.ReaderAt) uint64 {
+	b, err := e.bytes(r)
+	if err != nil {
+		return 0
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (e ebmlElement) float(r io.ReaderAt) float64 {
+	b, err := e.bytes(r)
+	if err != nil {
+		return 0
+	}
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	default:
+		return 0
+	}
+}
+
+// parseMatroska reads the duration and the properties of the first video and audio tracks from the segment.
+// It stops at the first cluster so that it doesn't read through the whole file.
+func parseMatroska(r io.ReaderAt, size int64, md *metadata) error {
+	top, err := ebmlElements(r, ebmlElement{size: size})
+	if len(top) < 2 || top[0].id != ebmlIDHeader || top[1].id != ebmlIDSegment {
+		if err != nil {
+			return err
+		}
+		return errMalformed
+	}
+	segment := top[1]
+	if segment.size < 0 || segment.offset+segment.size > size {
+		segment.size = size - segment.offset
+	}
+
+	es, err := ebmlElements(r, segment, ebmlIDCluster)
+	if err != nil && len(es) == 0 {
+		return err
+	}
+	for _, e := range es {
+		switch e.id {
+		case ebmlIDInfo:
+			var (
+				scale    uint64 = 1000000
+				duration float64
+			)
+			cs, _ := ebmlElements(r, e)
+			for _, c := range cs {
+				switch c.id {
+				case ebmlIDTimecodeScale:
+					scale = c.uint(r)
+				case ebmlIDDuration:
+					duration = c.float(r)
+				}
+			}
+			md.Duration = time.Duration(duration * float64(scale))
+		case ebmlIDTracks:
+			ts, _ := ebmlElements(r, e)
+			for _, t := range ts {
+				if t.id == ebmlIDTrackEntry {
+					parseMatroskaTrack(r, t, md)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func parseMatroskaTrack(r io.ReaderAt, track ebmlElement, md *metadata) {
+	var (
+		typ          uint64
+		codec        string
+		private      []byte
+		video, audio ebmlElement
+	)
+	cs, _ := ebmlElements(r, track)
+	for _, c := range cs {
+		switch c.id {
+		case ebmlIDTrackType:
+			typ = c.uint(r)
+		case ebmlIDCodecID:
+			b, _ := c.data(r, 64)
+			codec = matroskaCodec(string(b))
+		case ebmlIDCodecPrivate:
+			private, _ = c.data(r, 8)
+		case ebmlIDVideo:
+			video = c
+		case ebmlIDAudio:
+			audio = c
+		}
+	}
+
+	switch {
+	case typ == matroskaTrackVideo && md.Width == 0:
+		md.VideoCodec = codec
+		// The codec private data of H.264 is the AVC decoder configuration which tells the profile.
+		if codec == "h264" && len(private) >= 2 {
+			md.VideoProfile = int(private[1])
+		}
+		vs, _ := ebmlElements(r, video)
+		for _, v := range vs {
+			switch v.id {
+			case ebmlIDPixelWidth:
+				md.Width = int(v.uint(r))
+			case ebmlIDPixelHeight:
+				md.Height = int(v.uint(r))
+			}
+		}
+	case typ == matroskaTrackAudio && md.Channels == 0:
+		md.AudioCodec = codec
+		md.Channels = 1
+		as, _ := ebmlElements(r, audio)
+		for _, a := range as {
+			switch a.id {
+			case ebmlIDSamplingFrequency:
+				md.SampleRate = int(a.float(r))
+			case ebmlIDChannels:
+				md.Channels = int(a.uint(r))
+			}
+		}
+	}
+}
+
+// matroskaCodecs are the codecs by the prefixes of Matroska codec IDs.
+var matroskaCodecs = []struct {
+	prefix, codec string
+}{
+	{prefix: "V_MPEG4/ISO/AVC", codec: "h264"},
+	{prefix: "V_MPEGH/ISO/HEVC", codec: "hevc"},
+	{prefix: "V_MPEG4/ISO/", codec: "mpeg4"},
+	{prefix: "V_MPEG2", codec: "mpeg2"},
+	{prefix: "V_VP8", codec: "vp8"},
+	{prefix: "V_VP9", codec: "vp9"},
+	{prefix: "V_AV1", codec: "av1"},
+	{prefix: "A_AAC", codec: "aac"},
+	{prefix: "A_AC3", codec: "ac3"},
+	{prefix: "A_EAC3", codec: "eac3"},
+	{prefix: "A_DTS", codec: "dts"},
+	{prefix: "A_MPEG/L3", codec: "mp3"},
+	{prefix: "A_MPEG/L2", codec: "mp2"},
+	{prefix: "A_OPUS", codec: "opus"},
+	{prefix: "A_VORBIS", codec: "vorbis"},
+	{prefix: "A_FLAC", codec: "flac"},
+	{prefix: "A_PCM/INT/", codec: "lpcm"},
+}
+
+// matroskaCodec returns the codec of the Matroska codec ID, or "" if it's unknown.
+func matroskaCodec(id string) string {
+	id = strings.TrimRight(id, "\x00")
+	for _, c := range matroskaCodecs {
+		if strings.HasPrefix(id, c.prefix) {
+			return c.codec
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package cast
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseMatroska(t *testing.T) {
+	tests := []struct {
+		path string
+		want metadata
+	}{
+		{
+			path: "testdata/hevc.mkv",
+			want: metadata{Duration: time.Hour, Width: 1920, Height: 1080, Channels: 6, SampleRate: 48000, VideoCodec: "hevc", AudioCodec: "ac3"},
+		},
+		{
+			path: "testdata/vp9.webm",
+			want: metadata{Duration: time.Hour, Width: 1920, Height: 1080, Channels: 6, SampleRate: 48000, VideoCodec: "vp9", AudioCodec: "opus"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			b, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var md metadata
+			if err := parseMatroska(bytes.NewReader(b), int64(len(b)), &md); err != nil {
+				t.Fatal(err)
+			}
+			if md.Duration != tt.want.Duration || md.Width != tt.want.Width || md.Height != tt.want.Height ||
+				md.Channels != tt.want.Channels || md.SampleRate != tt.want.SampleRate ||
+				md.VideoCodec != tt.want.VideoCodec || md.AudioCodec != tt.want.AudioCodec {
+				t.Errorf("got %+v, want %+v", md, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMatroska_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "invalid length descriptor", data: []byte{0x00}},
+		{name: "header only", data: []byte{0x1A, 0x45, 0xDF, 0xA3, 0x80}},
+		{name: "not matroska", data: []byte("RIFF\x00\x00\x00\x00WAVE")},
+		{name: "oversized number", data: []byte{0x1A, 0x45, 0xDF, 0xA3, 0x80, 0x18, 0x53, 0x80, 0x67, 0x8B, 0x15, 0x49, 0xA9, 0x66, 0x86, 0x2A, 0xD7, 0xB1, 0x89, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			if err := parseMatroska(bytes.NewReader(tt.data), int64(len(tt.data)), &md); err == nil && md.Duration != 0 {
+				t.Errorf("got %+v", md)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package cast
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Media serves the file of the media item or the subtitle at /{id}{ext} where ext is the lower-cased extension of the file.
+// Subtitles are served in UTF-8 and also converted into SubRip or WebVTT for .srt or .vtt in place of ext.
+// Anything other than the published media items and their subtitles, including directories, is not found.
+// For Samsung TVs which ask for subtitles with getcaptioninfo.sec, the URL of the first subtitle of the video is in CaptionInfo.sec.
+// The DLNA transfer mode in transferMode.dlna.org is negotiated and, on getcontentFeatures.dlna.org, the DLNA operations and flags
+// of the item are in contentFeatures.dlna.org. HEAD requests get the same headers as GET.
+// MP4 and MPEG-TS videos can also be served from a time in TimeSeekRange.dlna.org.
+// The transcoded copies of the media items are streamed from the encoder at /{id}{ext} where ext is that of the profile.
+func (m *MediaLibrary) Media(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	id := strings.TrimSuffix(name, path.Ext(name))
+
+	m.mu.RLock()
+	i, ok := m.objects[id]
+	s, sub := m.subtitles[id]
+	t, tc := m.transcodes[id]
+	m.mu.RUnlock()
+	if sub {
+		serveSubtitle(w, r, s, path.Ext(name))
+		return
+	}
+	if tc && path.Base(t.URL.Path) == name {
+		m.serveTranscode(w, r, t)
+		return
+	}
+	if !ok || i.path == "" || path.Base(i.URL.Path) != name {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(i.path)
+	if err != nil {
+		log.WithField("path", i.path).WithError(err).Warn("Failed to open.")
+		http.NotFound(w, r)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !dlnaHeaders(w, r, i.ProtocolInfo) {
+		return
+	}
+	if i.mime != "*" {
+		w.Header().Set("Content-Type", i.mime)
+	}
+	if len(i.Subtitles) > 0 && r.Header.Get("getcaptioninfo.sec") == "1" {
+		// Set it as is since some TVs don't recognize the canonicalized Captioninfo.sec.
+		w.Header()["CaptionInfo.sec"] = []string{i.Subtitles[0].SRTURL.String()}
+	}
+	if r.Header.Get("TimeSeekRange.dlna.org") != "" {
+		serveTimeSeek(w, r, i, f, fi.Size())
+		return
+	}
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+}
@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"encoding/xml"
 	"fmt"
-	"io/fs"
+	"hash/fnv"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gabriel-vasile/mimetype"
 	log "github.com/sirupsen/logrus"
@@ -19,69 +24,580 @@ import (
 const xmlDeclaration = "<?xml version=\"1.0\"?>\n"
 
 type MediaLibrary struct {
-	Items MediaItems
+	BaseURL *url.URL
+	Roots   []Root
+
+	// ArtURL is the base URL of the cover art served by Art. If it's nil, no cover art is published.
+	ArtURL *url.URL
+
+	// ThumbnailDir is the directory where the resized copies of images are cached.
+	// If it's empty, they're made every time they're requested.
+	// The copies of the images removed or modified since are removed from it as the library is rebuilt.
+	ThumbnailDir string
+
+	// Transcoder is the path to ffmpeg, or an encoder with the same command line, which transcodes media files by TranscodeProfiles.
+	// If it's empty, no transcoded copies are offered.
+	Transcoder string
+
+	// TranscodeProfiles are the ways to transcode media files, which are offered as additional resources of the items.
+	TranscodeProfiles []TranscodeProfile
+
+	// MaxTranscodes is the maximum number of encoders running at once. If it's zero, only one runs at a time.
+	MaxTranscodes int
+
+	// IndexPath is the path to the file which persists the scan results across restarts.
+	// Files that haven't changed in size and modification time since the last scan are not examined again.
+	// If it's empty, every file is examined on every scan.
+	IndexPath string
+
+	// Workers is the number of files examined concurrently while scanning.
+	// If it's zero, runtime.NumCPU() is used.
+	Workers int
+
+	// Ignore is a list of gitignore-style patterns of paths to exclude from every root.
+	// Patterns in .castignore files take precedence over them.
+	Ignore []string
+
+	// Hidden publishes files and directories whose names start with a dot.
+	Hidden bool
+
+	// FollowSymlinks walks into symlinked directories.
+	FollowSymlinks bool
+
+	// Duplicates publishes symlinked directories even if their targets are published elsewhere in the library.
+	Duplicates bool
+
+	// AllFiles publishes files other than images, audio and videos as well as directories without any media in them.
+	AllFiles bool
+
+	// Recent is the maximum number of items in the "Recently Added" container. If it's zero, the container is omitted.
+	Recent int
+
+	// RecentAge excludes items added longer ago than it from the "Recently Added" container unless it's zero.
+	RecentAge time.Duration
+
+	ignore ignoreRules
+
+	// recentTimer expires the oldest of the recently added items.
+	recentTimer *time.Timer
+
+	transcodingOnce sync.Once
+	transcoding     chan struct{}
+
+	mu                 sync.RWMutex
+	entries            map[string]*entry
+	children           map[string]MediaItems
+	objects            map[string]*MediaItem
+	subtitles          map[string]*Subtitle
+	art                map[string]*Art
+	transcodes         map[string]*Transcode
+	systemUpdateID     int
+	containerUpdateIDs map[string]int
+}
+
+// Root is a directory published as a top-level container of the library.
+type Root struct {
+	// Label is the title of the container. If it's empty, the base name of Path is used.
+	Label string
+	Path  string
 }
 
+// root returns the root which contains path.
+func (m *MediaLibrary) root(path string) (*Root, bool) {
+	for i := range m.Roots {
+		r := &m.Roots[i]
+		if _, ok := r.rel(path); ok {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// isRoot tells if path is one of the roots.
+func (m *MediaLibrary) isRoot(path string) bool {
+	for _, r := range m.Roots {
+		if r.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// rel returns the slash-separated path of path relative to the root.
+// It returns false if path isn't under the root.
+func (r *Root) rel(path string) (string, bool) {
+	rel, err := filepath.Rel(r.Path, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// id returns the object ID for the slash-separated path relative to the root.
+// It's derived from the label and the relative path so that it stays the same across restarts and rescans.
+func (r *Root) id(rel string) string {
+	if rel == "." {
+		return objectID(r.Label)
+	}
+	return objectID(r.Label, rel)
+}
+
+// entry is a directory or a file found under the library roots.
+// Its fields are exported so that it can be persisted in the index.
+type entry struct {
+	Dir     bool
+	Size    int64
+	ModTime time.Time
+	MIME    string
+	Meta    metadata
+	// Added is when the file was found for the first time, or zero if it's unknown.
+	Added time.Time
+
+	// link is the target of the symlinked directory.
+	link *fileID
+}
+
+// NewMediaLibrary returns the library which publishes dir at baseURL, scanned with the default settings.
+// It's a shorthand for Scan of a MediaLibrary with dir as its only root.
 func NewMediaLibrary(baseURL *url.URL, dir string) (*MediaLibrary, error) {
+	m := MediaLibrary{
+		BaseURL: baseURL,
+		Roots:   []Root{{Path: dir}},
+	}
+	if err := m.Scan(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Items returns the objects in the content tree other than the root, each container followed by its descendants.
+func (m *MediaLibrary) Items() MediaItems {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	var (
-		items        []MediaItem
-		id           int
-		containerIDs = map[string]int{}
+		items MediaItems
+		walk  func(id string)
 	)
-	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+	walk = func(id string) {
+		for _, i := range m.children[id] {
+			items = append(items, i)
+			walk(i.ID)
+		}
+	}
+	walk(rootID)
+	return items
+}
+
+// Scan walks the library roots and builds the content tree from scratch.
+func (m *MediaLibrary) Scan() error {
+	labels := make(map[string]struct{}, len(m.Roots))
+	for i := range m.Roots {
+		r := &m.Roots[i]
+		path, err := filepath.Abs(r.Path)
 		if err != nil {
-			log.WithField("path", path).WithError(err).Warn("Failed to walk")
-			return nil
+			return err
+		}
+		r.Path = path
+		if r.Label == "" {
+			r.Label = filepath.Base(path)
+		}
+		if r.Label == "." || r.Label == ".." || strings.Contains(r.Label, "/") {
+			return fmt.Errorf("invalid label: %s", r.Label)
+		}
+		if _, ok := labels[r.Label]; ok {
+			return fmt.Errorf("duplicate label: %s", r.Label)
+		}
+		labels[r.Label] = struct{}{}
+	}
+	for i := range m.Roots {
+		for j := range m.Roots {
+			if _, ok := m.Roots[i].rel(m.Roots[j].Path); i != j && ok {
+				return fmt.Errorf("nested roots: %s, %s", m.Roots[i].Path, m.Roots[j].Path)
+			}
+		}
+	}
+
+	ignore, err := parseIgnoreRules(".", m.Ignore)
+	if err != nil {
+		return err
+	}
+	m.ignore = ignore
+
+	known := m.loadIndex()
+	// Without an index, files found now can't be told from the ones which have been there for long.
+	fresh := known == nil
+	if fresh {
+		known = map[string]*entry{}
+	}
+	entries := map[string]*entry{}
+	for i := range m.Roots {
+		r := &m.Roots[i]
+		es, err := m.scan(r, r.Path, known, nil)
+		if err != nil {
+			return err
+		}
+		for p, e := range es {
+			if fresh {
+				e.Added = time.Time{}
+			}
+			entries[p] = e
+			known[p] = e
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = entries
+	m.rebuild()
+	m.saveIndex()
+	return nil
+}
+
+// same tells if e is the same as f. Files are the same only if they haven't been examined again.
+func (e *entry) same(f *entry) bool {
+	if e == f {
+		return true
+	}
+	if !e.Dir || !f.Dir {
+		return false
+	}
+	if e.link == nil || f.link == nil {
+		return e.link == f.link
+	}
+	return *e.link == *f.link
+}
+
+func newFileEntry(path string, known map[string]*entry) (*entry, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	old, ok := known[path]
+	if ok && !old.Dir && old.Size == fi.Size() && old.ModTime.Equal(fi.ModTime()) {
+		return old, nil
+	}
+
+	e := entry{
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		MIME:    "*",
+		Added:   time.Now(),
+	}
+	if ok {
+		e.Added = old.Added
+	}
+	if t, ok := playlistTypes[strings.ToLower(filepath.Ext(path))]; ok {
+		e.MIME = t
+	} else if m, err := mimetype.DetectFile(path); err == nil {
+		e.MIME = m.String()
+	}
+	if e.MIME == "application/octet-stream" && isMPEGTS(path) {
+		e.MIME = "video/mp2t"
+	}
+	probe(path, &e)
+	return &e, nil
+}
+
+func (e *entry) class() MediaClass {
+	if e.Dir {
+		return MediaClassStorageFolder
+	}
+	for _, t := range playlistTypes {
+		if e.MIME == t {
+			return MediaClassPlaylistContainer
+		}
+	}
+	switch strings.Split(e.MIME, "/")[0] {
+	case "image":
+		if e.Meta.Date != "" {
+			return MediaClassPhoto
 		}
+		return MediaClassImageItem
+	case "audio":
+		if e.Meta.tagged() {
+			return MediaClassMusicTrack
+		}
+		return MediaClassAudioItem
+	case "video":
+		return MediaClassVideoItem
+	case "text":
+		return MediaClassTextItem
+	default:
+		return MediaClassItem
+	}
+}
+
+// rebuild reconstructs the content tree from the entries.
+// Containers whose children have changed get the current system update ID as their container update ID.
+// It must be called with m.mu locked.
+func (m *MediaLibrary) rebuild() {
+	if m.containerUpdateIDs == nil {
+		m.containerUpdateIDs = map[string]int{}
+	}
+
+	paths := make([]string, 0, len(m.entries))
+	for p := range m.entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var (
+		children  = map[string]MediaItems{}
+		tracks    MediaItems
+		images    MediaItems
+		files     MediaItems
+		playlists []playlist
+		sidecars  = m.sidecars(paths)
+		covers    = m.covers(paths)
+		subtitles = map[string]*Subtitle{}
+	)
+	for _, r := range m.Roots {
+		children[rootID] = append(children[rootID], MediaItem{
+			ID:       r.id("."),
+			ParentID: rootID,
+			Title:    r.Label,
+			Class:    MediaClassStorageFolder,
+			AlbumArt: covers[r.Path],
+		})
+
+		for _, p := range paths {
+			rel, ok := r.rel(p)
+			if !ok || rel == "." {
+				continue
+			}
 
-		parentID := containerIDs[filepath.Dir(path)]
-
-		if d.IsDir() {
-			items = append(items, MediaItem{
-				ID:       id,
-				ParentID: parentID,
-				Title:    d.Name(),
-				Class:    MediaClassStorageFolder,
-			})
-			containerIDs[path] = id
-		} else {
-			var (
-				class = MediaClassItem
-				mime  = "*"
-			)
-			if m, err := mimetype.DetectFile(path); err == nil {
-				mime = m.String()
-				switch strings.Split(mime, "/")[0] {
-				case "image":
-					class = MediaClassImageItem
-				case "audio":
-					class = MediaClassAudioItem
-				case "video":
-					class = MediaClassVideoItem
+			e := m.entries[p]
+			if c := e.class(); !m.AllFiles && (c == MediaClassItem || c == MediaClassTextItem) {
+				continue
+			}
+
+			parentID := r.id(path.Dir(rel))
+			i := m.item(&r, rel, e, parentID)
+			switch {
+			case e.Dir:
+				i.AlbumArt = covers[p]
+			case e.Meta.Picture.Size > 0:
+				i.AlbumArt = m.embeddedArt(i, e)
+			case i.Class == MediaClassImageItem, i.Class == MediaClassPhoto:
+				i.Variants = m.variants(i, e)
+				if len(i.Variants) > 0 {
+					i.AlbumArt = i.Variants[0]
 				}
+			default:
+				i.AlbumArt = covers[filepath.Dir(p)]
+			}
+			if !e.Dir {
+				i.Transcodes = m.transcoded(i, e)
 			}
+			if i.Class == MediaClassVideoItem {
+				i.Subtitles = matchSubtitles(sidecars[filepath.Dir(p)], path.Base(rel))
+				for n := range i.Subtitles {
+					subtitles[i.Subtitles[n].ID] = &i.Subtitles[n]
+				}
+			}
+			children[parentID] = append(children[parentID], i)
+			switch {
+			case i.Class == MediaClassPlaylistContainer:
+				playlists = append(playlists, playlist{item: i, dir: filepath.Dir(p), entries: e.Meta.Playlist})
+			case !e.Dir:
+				files = append(files, i)
+			}
+			switch i.Class {
+			case MediaClassMusicTrack:
+				tracks = append(tracks, i)
+			case MediaClassImageItem, MediaClassPhoto:
+				images = append(images, i)
+			}
+		}
+	}
+	// Playlists may refer to files in any root and are left out if they end up empty, which may leave their folders empty.
+	addPlaylists(children, playlists, files)
+	if !m.AllFiles {
+		for _, r := range m.Roots {
+			prune(children, r.id("."))
+		}
+	}
+	m.addRecent(children, files)
+	addMusic(children, tracks)
+	addPhotos(children, images)
 
-			rel, err := filepath.Rel(dir, path)
-			if err != nil {
-				return err
+	for id, items := range children {
+		if !sameIDs(items, m.children[id]) {
+			m.containerUpdateIDs[id] = m.systemUpdateID
+		}
+	}
+	for id := range m.children {
+		if _, ok := children[id]; !ok {
+			m.containerUpdateIDs[id] = m.systemUpdateID
+		}
+	}
+
+	root := container(rootID, "-1", "root", MediaClassContainer)
+	root.ChildCount = len(children[rootID])
+	objects := map[string]*MediaItem{rootID: &root}
+	art := map[string]*Art{}
+	transcodes := map[string]*Transcode{}
+	for _, items := range children {
+		for i := range items {
+			items[i].ChildCount = len(children[items[i].ID])
+			objects[items[i].ID] = &items[i]
+			if a := items[i].AlbumArt; a != nil {
+				art[a.ID] = a
+			}
+			for _, a := range items[i].Variants {
+				art[a.ID] = a
 			}
+			for _, t := range items[i].Transcodes {
+				transcodes[t.ID] = t
+			}
+		}
+	}
 
-			items = append(items, MediaItem{
-				ID:           id,
-				ParentID:     parentID,
-				Title:        d.Name(),
-				Class:        class,
-				ProtocolInfo: fmt.Sprintf("http-get:*:%s:*", mime),
-				URL:          baseURL.ResolveReference(&url.URL{Path: rel}),
-			})
+	m.children = children
+	m.objects = objects
+	m.subtitles = subtitles
+	m.art = art
+	m.transcodes = transcodes
+
+	if m.ThumbnailDir != "" {
+		keep := map[string]struct{}{}
+		for _, a := range art {
+			if e, ok := m.entries[a.path]; ok && a.profile != "" {
+				keep[thumbnailCache(a, e.ModTime)] = struct{}{}
+			}
 		}
+		// The cache is pruned in the background so that the requests aren't blocked while the directory is read.
+		go pruneThumbnails(m.ThumbnailDir, keep)
+	}
+}
 
-		id++
-		return nil
-	}); err != nil {
-		return nil, err
+// prune removes containers without any items in them from the subtree of the container id.
+// It returns false if the container itself is empty.
+func prune(children map[string]MediaItems, id string) bool {
+	items := children[id][:0]
+	for _, i := range children[id] {
+		if i.Class == MediaClassStorageFolder && !prune(children, i.ID) {
+			continue
+		}
+		items = append(items, i)
+	}
+	if len(items) == 0 {
+		delete(children, id)
+		return false
 	}
-	return &MediaLibrary{Items: items}, nil
+	children[id] = items
+	return true
+}
+
+// rootID is the object ID of the container which contains the library roots.
+const rootID = "0"
+
+// objectID returns an object ID which is safe in both DIDL-Lite and SOAP.
+func objectID(elems ...string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strings.Join(elems, "\x00")))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// virtualID returns the object ID of a virtual container.
+// Its first element is empty so that it never collides with the object IDs of the library roots.
+func virtualID(elems ...string) string {
+	return objectID(append([]string{""}, elems...)...)
+}
+
+// ref returns a reference to the item i in the virtual container parentID.
+func ref(i MediaItem, parentID string) MediaItem {
+	r := i
+	r.ID = objectID(parentID, i.ID)
+	r.ParentID = parentID
+	r.RefID = i.ID
+	return r
+}
+
+// container returns a virtual container.
+func container(id, parentID, title string, class MediaClass) MediaItem {
+	return MediaItem{
+		ID:       id,
+		ParentID: parentID,
+		Title:    title,
+		Class:    class,
+	}
+}
+
+func (m *MediaLibrary) item(r *Root, rel string, e *entry, parentID string) MediaItem {
+	i := MediaItem{
+		ID:       r.id(rel),
+		ParentID: parentID,
+		Title:    path.Base(rel),
+		Class:    e.class(),
+	}
+	if i.Class == MediaClassPlaylistContainer {
+		i.Title = strings.TrimSuffix(i.Title, path.Ext(i.Title))
+	}
+	if i.Class.DerivedFrom(MediaClassAudioItem.String()) && strings.EqualFold(path.Ext(rel), ".m4b") {
+		i.Class = MediaClassAudioBook
+	}
+	if i.Class.Container() {
+		return i
+	}
+
+	ops := dlnaOpRange
+	if e.Meta.TimeSeekable && e.Meta.Duration > 0 {
+		i.timeSeekable = true
+		ops |= dlnaOpTimeSeek
+	}
+	i.ProtocolInfo = protocolInfo(e.MIME, dlnaProfile(e.MIME, &e.Meta), false, ops)
+	i.Size = e.Size
+	i.Duration = Duration(e.Meta.Duration)
+	if w, h := e.Meta.Width, e.Meta.Height; w > 0 && h > 0 {
+		// Images turned by 90 degrees are shown in the resolution of their upright form, as their variants are.
+		if e.Meta.Orientation >= 5 {
+			w, h = h, w
+		}
+		i.Resolution = fmt.Sprintf("%dx%d", w, h)
+	}
+	i.Bitrate = e.Meta.Bitrate
+	i.NrAudioChannels = e.Meta.Channels
+	i.SampleFrequency = e.Meta.SampleRate
+	if e.Meta.Title != "" {
+		i.Title = e.Meta.Title
+	}
+	i.Artist = e.Meta.Artist
+	if i.Artist == "" {
+		i.Artist = e.Meta.AlbumArtist
+	}
+	i.albumArtist = e.Meta.AlbumArtist
+	if i.albumArtist == "" {
+		i.albumArtist = i.Artist
+	}
+	i.Album = e.Meta.Album
+	i.Genre = e.Meta.Genre
+	i.OriginalTrackNumber = e.Meta.Track
+	i.Date = e.Meta.Date
+	i.Orientation = e.Meta.Orientation
+	i.URL = m.BaseURL.ResolveReference(&url.URL{Path: i.ID + strings.ToLower(path.Ext(rel))})
+	i.path = filepath.Join(r.Path, filepath.FromSlash(rel))
+	i.mime = e.MIME
+	i.modTime = e.ModTime
+	i.added = e.ModTime
+	if e.Added.After(i.added) {
+		i.added = e.Added
+	}
+	return i
+}
+
+func sameIDs(a, b MediaItems) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			return false
+		}
+	}
+	return true
 }
 
 func (m *MediaLibrary) Control(w http.ResponseWriter, r *http.Request) {
@@ -258,37 +774,66 @@ func (m MediaItems) String() string {
 }
 
 type MediaItem struct {
-	ID           int
-	ParentID     int
+	ID       string
+	ParentID string
+	// RefID is the ID of the item which this item refers to, if any.
+	RefID        string
 	Restricted   int
 	Title        string
 	Class        MediaClass
 	ProtocolInfo string
 	URL          *url.URL
-}
 
-type MediaClass int
-
-const (
-	MediaClassStorageFolder MediaClass = iota
-	MediaClassItem
-	MediaClassImageItem
-	MediaClassAudioItem
-	MediaClassVideoItem
-)
-
-func (c MediaClass) String() string {
-	return [...]string{
-		MediaClassStorageFolder: "object.container.storageFolder",
-		MediaClassItem:          "object.item",
-		MediaClassImageItem:     "object.item.imageItem",
-		MediaClassAudioItem:     "object.item.audioItem",
-		MediaClassVideoItem:     "object.item.videoItem",
-	}[c]
+	// Size is the size of the resource in bytes.
+	Size int64
+	// Duration is the playback duration of the resource.
+	Duration Duration
+	// Resolution is the resolution of the resource in the form of WIDTHxHEIGHT.
+	Resolution string
+	// Bitrate is the bitrate of the resource in bytes per second.
+	Bitrate int
+	// NrAudioChannels is the number of audio channels of the resource.
+	NrAudioChannels int
+	// SampleFrequency is the sample frequency of the audio of the resource in Hz.
+	SampleFrequency int
+
+	Artist              string
+	Album               string
+	Genre               string
+	OriginalTrackNumber int
+	// Date is in the form of YYYY-MM-DD, optionally followed by THH:MM:SS.
+	Date string
+	// Orientation is the EXIF orientation of the image, 1 to 8, or 0 if unknown.
+	// Resolution is of the image turned upright by it.
+	// There's no standard property for it so it's in cast:orientation of the item.
+	Orientation int
+	// ChildCount is the number of the children of the container.
+	ChildCount int
+	// Subtitles are the sidecar subtitles of the video.
+	Subtitles []Subtitle
+	// AlbumArt is the cover art of the container or the item, if any.
+	AlbumArt *Art
+	// Variants are the resized copies of the image in DLNA media format profiles.
+	Variants []*Art
+	// Transcodes are the copies of the item transcoded on the fly.
+	Transcodes []*Transcode
+
+	// albumArtist is the album artist of the track, or its artist if it has none.
+	albumArtist string
+	path        string
+	mime        string
+	modTime     time.Time
+	// timeSeekable tells if the file can be served from a time with TimeSeekRange.dlna.org.
+	timeSeekable bool
+	// added is the later of the modification time and when the file was found for the first time.
+	added time.Time
 }
 
 func (m *MediaLibrary) getSearchCapabilities(p *action) (*actionResponse, error) {
-	return p.response(), nil
+	return p.response(argument{
+		XMLName: xml.Name{Local: "SearchCaps"},
+		Value:   strings.Join(searchProperties, ","),
+	}), nil
 }
 
 func (m *MediaLibrary) getSortCapabilities(p *action) (*actionResponse, error) {
@@ -307,7 +852,13 @@ func (m *MediaLibrary) getFeatureList(p *action) (*actionResponse, error) {
 }
 
 func (m *MediaLibrary) getSystemUpdateID(p *action) (*actionResponse, error) {
-	return p.response(), nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return p.response(argument{
+		XMLName: xml.Name{Local: "Id"},
+		Value:   strconv.Itoa(m.systemUpdateID),
+	}), nil
 }
 
 func (m *MediaLibrary) getServiceResetToken(p *action) (*actionResponse, error) {
@@ -315,37 +866,37 @@ func (m *MediaLibrary) getServiceResetToken(p *action) (*actionResponse, error)
 }
 
 func (m *MediaLibrary) browse(p *action) (*actionResponse, error) {
-	var parentID int
+	var objectID, flag string
 	for _, arg := range p.Arguments {
 		switch arg.XMLName.Local {
 		case "ObjectID":
-			id, err := strconv.Atoi(arg.Value)
-			if err != nil {
-				return nil, err
-			}
-			parentID = id
+			objectID = arg.Value
+		case "BrowseFlag":
+			flag = arg.Value
 		}
 	}
 
-	res := make(MediaItems, 0, len(m.Items))
-	for _, i := range m.Items {
-		if i.ParentID == parentID {
-			res = append(res, i)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var res MediaItems
+	switch flag {
+	case "BrowseMetadata":
+		if o, ok := m.objects[objectID]; ok {
+			res = MediaItems{*o}
 		}
+	default:
+		res = m.children[objectID]
 	}
 
 	return p.response([]argument{
 		{XMLName: xml.Name{Local: "Result"}, Value: res.String()},
 		{XMLName: xml.Name{Local: "NumberReturned"}, Value: strconv.Itoa(len(res))},
 		{XMLName: xml.Name{Local: "TotalMatches"}, Value: strconv.Itoa(len(res))},
-		{XMLName: xml.Name{Local: "UpdateID"}, Value: "1"},
+		{XMLName: xml.Name{Local: "UpdateID"}, Value: strconv.Itoa(m.containerUpdateIDs[objectID])},
 	}...), nil
 }
 
-func (m *MediaLibrary) search(p *action) (*actionResponse, error) {
-	return p.response(), nil
-}
-
 func (m *MediaLibrary) createObject(p *action) (*actionResponse, error) {
 	return p.response(), nil
 }
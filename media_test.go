@@ -0,0 +1,101 @@
+package cast
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMediaLibrary_Media(t *testing.T) {
+	dir := t.TempDir()
+	b, err := os.ReadFile("testdata/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a.jpg", "skip.jpg", "d/b.jpg"} {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := MediaLibrary{BaseURL: &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"}, Roots: []Root{{Path: dir}}, Ignore: []string{"skip.jpg"}}
+	if err := m.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	r := &m.Roots[0]
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "file", path: "/" + r.id("a.jpg") + ".jpg", want: http.StatusOK},
+		{name: "file in directory", path: "/" + r.id("d/b.jpg") + ".jpg", want: http.StatusOK},
+		{name: "unknown ID", path: "/0123456789abcdef.jpg", want: http.StatusNotFound},
+		{name: "ignored file", path: "/" + r.id("skip.jpg") + ".jpg", want: http.StatusNotFound},
+		{name: "directory", path: "/" + r.id("d"), want: http.StatusNotFound},
+		{name: "directory with extension", path: "/" + r.id("d") + ".jpg", want: http.StatusNotFound},
+		{name: "root", path: "/" + rootID, want: http.StatusNotFound},
+		{name: "mismatched extension", path: "/" + r.id("a.jpg") + ".png", want: http.StatusNotFound},
+		{name: "upper-cased extension", path: "/" + r.id("a.jpg") + ".JPG", want: http.StatusNotFound},
+		{name: "no extension", path: "/" + r.id("a.jpg"), want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			m.Media(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaLibrary_Media_Head(t *testing.T) {
+	dir := t.TempDir()
+	b, err := os.ReadFile("testdata/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := MediaLibrary{BaseURL: &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"}, Roots: []Root{{Path: dir}}}
+	if err := m.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	p := "/" + m.Roots[0].id("a.jpg") + ".jpg"
+
+	// HEAD requests get the same headers as GET but no body.
+	var rs []*httptest.ResponseRecorder
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		r := httptest.NewRequest(method, p, nil)
+		r.Header.Set("getcontentFeatures.dlna.org", "1")
+		r.Header.Set("transferMode.dlna.org", "Interactive")
+		w := httptest.NewRecorder()
+		m.Media(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d, want %d", method, w.Code, http.StatusOK)
+		}
+		rs = append(rs, w)
+	}
+	get, head := rs[0], rs[1]
+	for _, k := range []string{"Content-Type", "Content-Length", "Last-Modified", "transferMode.dlna.org", "contentFeatures.dlna.org"} {
+		if g, h := get.Header()[k], head.Header()[k]; len(g) != 1 || len(h) != 1 || g[0] != h[0] {
+			t.Errorf("%s: got %q, want %q", k, h, g)
+		}
+	}
+	if get.Body.Len() != len(b) {
+		t.Errorf("got %d, want %d", get.Body.Len(), len(b))
+	}
+	if head.Body.Len() != 0 {
+		t.Errorf("got %d, want 0", head.Body.Len())
+	}
+}
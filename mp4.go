@@ -0,0 +1,533 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var errMalformed = errors.New("malformed")
+
+// mp4Box is a box of an ISO base media file, e.g. MP4 and MOV.
+type mp4Box struct {
+	typ string
+	// offset is the offset of the payload.
+	offset int64
+	// size is the size of the payload.
+	size int64
+}
+
+// mp4Boxes returns the boxes in the payload of the parent.
+func mp4Boxes(r io.ReaderAt, parent mp4Box) ([]mp4Box, error) {
+	var (
+		boxes  []mp4Box
+		offset = parent.offset
+		end    = parent.offset + parent.size
+	)
+	for offset+8 <= end {
+		var h [16]byte
+		if _, err := r.ReadAt(h[:8], offset); err != nil {
+			return boxes, err
+		}
+		size, hdr := int64(binary.BigEndian.Uint32(h[:4])), int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(h[8:], offset+8); err != nil {
+				return boxes, err
+			}
+			size, hdr = int64(binary.BigEndian.Uint64(h[8:])), 16
+		}
+		if size < hdr || size > end-offset {
+			return boxes, errMalformed
+		}
+		boxes = append(boxes, mp4Box{
+			typ:    string(h[4:8]),
+			offset: offset + hdr,
+			size:   size - hdr,
+		})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// mp4Find returns the first box at the path of box types under the parent.
+func mp4Find(r io.ReaderAt, parent mp4Box, path ...string) (mp4Box, bool) {
+	for _, typ := range path {
+		boxes, err := mp4Boxes(r, parent)
+		if err != nil && len(boxes) == 0 {
+			return mp4Box{}, false
+		}
+		found := false
+		for _, b := range boxes {
+			if b.typ == typ {
+				parent, found = b, true
+				break
+			}
+		}
+		if !found {
+			return mp4Box{}, false
+		}
+	}
+	return parent, true
+}
+
+// read returns the payload of the box from offset up to n bytes.
+func (b mp4Box) read(r io.ReaderAt, offset, n int64) ([]byte, error) {
+	if offset+n > b.size {
+		n = b.size - offset
+	}
+	if n < 0 {
+		return nil, errMalformed
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, b.offset+offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// parseMP4 reads the duration, the properties of the first video and audio tracks and the iTunes-style tags from the moov box.
+func parseMP4(r io.ReaderAt, size int64, md *metadata) error {
+	moov, ok := mp4Find(r, mp4Box{size: size}, "moov")
+	if !ok {
+		return errMalformed
+	}
+
+	if mvhd, ok := mp4Find(r, moov, "mvhd"); ok {
+		b, err := mvhd.read(r, 0, 32)
+		if err != nil {
+			return err
+		}
+		var timescale, duration uint64
+		switch {
+		case len(b) >= 32 && b[0] == 1:
+			timescale, duration = uint64(binary.BigEndian.Uint32(b[20:])), binary.BigEndian.Uint64(b[24:])
+		case len(b) >= 20:
+			timescale, duration = uint64(binary.BigEndian.Uint32(b[12:])), uint64(binary.BigEndian.Uint32(b[16:]))
+		}
+		if timescale > 0 {
+			md.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+		}
+	}
+
+	traks, err := mp4Boxes(r, moov)
+	if err != nil && len(traks) == 0 {
+		return err
+	}
+	for _, trak := range traks {
+		if trak.typ != "trak" {
+			continue
+		}
+
+		hdlr, ok := mp4Find(r, trak, "mdia", "hdlr")
+		if !ok {
+			continue
+		}
+		b, err := hdlr.read(r, 8, 4)
+		if err != nil {
+			continue
+		}
+		stsd, ok := mp4Find(r, trak, "mdia", "minf", "stbl", "stsd")
+		if !ok {
+			continue
+		}
+		// The first sample entry follows the full box header and the entry count.
+		entry, err := stsd.read(r, 8, mp4SampleEntryLimit)
+		if err != nil || len(entry) < 8+28 {
+			continue
+		}
+		codec, se := mp4Codecs[string(entry[4:8])], entry[8:]
+
+		switch string(b) {
+		case "vide":
+			if md.Width > 0 {
+				continue
+			}
+			md.Width, md.Height = int(binary.BigEndian.Uint16(se[24:])), int(binary.BigEndian.Uint16(se[26:]))
+			md.VideoCodec = codec
+			// The AVC decoder configuration tells the profile.
+			if i := bytes.Index(entry, []byte("avcC")); codec == "h264" && i >= 0 && i+6 <= len(entry) {
+				md.VideoProfile = int(entry[i+5])
+			}
+			if tkhd, ok := mp4Find(r, trak, "tkhd"); ok {
+				if b, err := tkhd.read(r, 0, 96); err == nil && len(b) > 0 {
+					off := 76
+					if b[0] == 1 {
+						off = 88
+					}
+					if len(b) >= off+8 {
+						if w, h := int(binary.BigEndian.Uint32(b[off:])>>16), int(binary.BigEndian.Uint32(b[off+4:])>>16); w > 0 && h > 0 {
+							md.Width, md.Height = w, h
+						}
+					}
+				}
+			}
+		case "soun":
+			if md.Channels > 0 {
+				continue
+			}
+			md.AudioCodec = codec
+			md.Channels = int(binary.BigEndian.Uint16(se[16:]))
+			md.SampleRate = int(binary.BigEndian.Uint32(se[24:]) >> 16)
+		}
+	}
+
+	parseMP4Tags(r, moov, md)
+
+	_, err = newMP4Index(r, size)
+	md.TimeSeekable = err == nil
+	return nil
+}
+
+// mp4SampleEntryLimit is the maximum size of a sample entry read for the codec and its configuration.
+const mp4SampleEntryLimit = 512
+
+// mp4Codecs are the codecs by the types of sample entries.
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"mp4v": "mpeg4",
+	"s263": "h263",
+	"vp09": "vp9",
+	"av01": "av1",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+	"alac": "alac",
+	"lpcm": "lpcm",
+	"sowt": "lpcm",
+	"twos": "lpcm",
+	".mp3": "mp3",
+	"samr": "amr",
+}
+
+// mp4TagLimit is the maximum size of a tag value. Larger ones, e.g. cover art, are skipped.
+const mp4TagLimit = 64 << 10
+
+// parseMP4Tags reads the tags in moov/udta/meta/ilst.
+func parseMP4Tags(r io.ReaderAt, moov mp4Box, md *metadata) {
+	meta, ok := mp4Find(r, moov, "udta", "meta")
+	if !ok {
+		return
+	}
+	// In MP4, meta is a full box while it isn't in QuickTime.
+	if b, err := meta.read(r, 4, 4); err == nil && string(b) != "hdlr" {
+		meta.offset, meta.size = meta.offset+4, meta.size-4
+	}
+	ilst, ok := mp4Find(r, meta, "ilst")
+	if !ok {
+		return
+	}
+	items, _ := mp4Boxes(r, ilst)
+	for _, item := range items {
+		data, ok := mp4Find(r, item, "data")
+		if !ok || data.size < 8 || data.size > mp4TagLimit {
+			continue
+		}
+		b, err := data.read(r, 0, data.size)
+		if err != nil {
+			continue
+		}
+		// The payload starts with the type indicator and the locale.
+		typ, value := binary.BigEndian.Uint32(b)&0xffffff, b[8:]
+		text := strings.TrimSpace(string(value))
+
+		switch item.typ {
+		case "\xa9nam":
+			md.Title = text
+		case "\xa9ART":
+			md.Artist = text
+		case "aART":
+			md.AlbumArtist = text
+		case "\xa9alb":
+			md.Album = text
+		case "\xa9gen":
+			md.Genre = text
+		case "gnre":
+			// gnre is an ID3v1 genre plus one.
+			if typ == 0 && len(value) >= 2 {
+				if n := int(binary.BigEndian.Uint16(value)); n > 0 && n <= len(id3Genres) && md.Genre == "" {
+					md.Genre = id3Genres[n-1]
+				}
+			}
+		case "trkn":
+			if len(value) >= 4 {
+				md.Track = int(binary.BigEndian.Uint16(value[2:]))
+			}
+		case "\xa9day":
+			md.Date = normalizeDate(text)
+		}
+	}
+}
+
+// mp4TableLimit is the maximum size of a sample table box.
+const mp4TableLimit = 64 << 20
+
+// mp4Index is the sample table of the first video track, or the first audio track if there's no video, of an MP4 file.
+type mp4Index struct {
+	timescale uint32
+	// stts is the pairs of a sample count and a sample delta.
+	stts []uint32
+	// stss is the sync samples numbered from 1. All samples are sync samples if it's empty.
+	stss []uint32
+	// stsc is the triples of a first chunk numbered from 1, samples per chunk and a sample description index.
+	stsc []uint32
+	// chunks are the offsets of the chunks.
+	chunks []uint64
+	// sampleSize is the size of every sample, or 0 if they're in sizes.
+	sampleSize uint32
+	sizes      []uint32
+}
+
+// newMP4Index reads the sample table from the moov box.
+func newMP4Index(r io.ReaderAt, size int64) (*mp4Index, error) {
+	moov, ok := mp4Find(r, mp4Box{size: size}, "moov")
+	if !ok {
+		return nil, errMalformed
+	}
+	boxes, err := mp4Boxes(r, moov)
+	if err != nil && len(boxes) == 0 {
+		return nil, err
+	}
+	var trak mp4Box
+	for _, b := range boxes {
+		if b.typ != "trak" {
+			continue
+		}
+		hdlr, ok := mp4Find(r, b, "mdia", "hdlr")
+		if !ok {
+			continue
+		}
+		h, err := hdlr.read(r, 8, 4)
+		if err != nil {
+			continue
+		}
+		if string(h) == "vide" {
+			trak = b
+			break
+		}
+		if string(h) == "soun" && trak.typ == "" {
+			trak = b
+		}
+	}
+	if trak.typ == "" {
+		return nil, errMalformed
+	}
+
+	var idx mp4Index
+	mdhd, ok := mp4Find(r, trak, "mdia", "mdhd")
+	if !ok {
+		return nil, errMalformed
+	}
+	b, err := mdhd.read(r, 0, 24)
+	if err != nil || len(b) < 24 {
+		return nil, errMalformed
+	}
+	if b[0] == 1 {
+		idx.timescale = binary.BigEndian.Uint32(b[20:])
+	} else {
+		idx.timescale = binary.BigEndian.Uint32(b[12:])
+	}
+
+	stbl, ok := mp4Find(r, trak, "mdia", "minf", "stbl")
+	if !ok {
+		return nil, errMalformed
+	}
+	tables, err := mp4Boxes(r, stbl)
+	if err != nil && len(tables) == 0 {
+		return nil, err
+	}
+	for _, t := range tables {
+		if t.size > mp4TableLimit {
+			return nil, errMalformed
+		}
+		switch t.typ {
+		case "stts", "stss", "stsc", "stco", "co64", "stsz":
+		default:
+			continue
+		}
+		b, err := t.read(r, 0, t.size)
+		if err != nil {
+			return nil, err
+		}
+		// The entries follow the full box header and the entry count, or the sample size and the sample count in stsz.
+		if len(b) < 8 || (t.typ == "stsz" && len(b) < 12) {
+			return nil, errMalformed
+		}
+		switch t.typ {
+		case "stts":
+			idx.stts = uint32s(b[8:])
+		case "stss":
+			idx.stss = uint32s(b[8:])
+		case "stsc":
+			idx.stsc = uint32s(b[8:])
+		case "stco":
+			for _, o := range uint32s(b[8:]) {
+				idx.chunks = append(idx.chunks, uint64(o))
+			}
+		case "co64":
+			for b = b[8:]; len(b) >= 8; b = b[8:] {
+				idx.chunks = append(idx.chunks, binary.BigEndian.Uint64(b))
+			}
+		case "stsz":
+			idx.sampleSize = binary.BigEndian.Uint32(b[4:])
+			if idx.sampleSize == 0 {
+				idx.sizes = uint32s(b[12:])
+			}
+		}
+	}
+	if idx.timescale == 0 || len(idx.stts) < 2 || len(idx.stsc) < 3 || len(idx.chunks) == 0 {
+		// Fragmented files have empty sample tables.
+		return nil, errMalformed
+	}
+	if !idx.valid(size) {
+		return nil, errMalformed
+	}
+	return &idx, nil
+}
+
+// valid tells if every sample is in a chunk within the file so that seek never looks beyond the tables.
+func (idx *mp4Index) valid(size int64) bool {
+	// The first chunks of the runs start at 1 and increase within the chunks.
+	if idx.stsc[0] != 1 {
+		return false
+	}
+	var prev uint32
+	for i := 0; i+2 < len(idx.stsc); i += 3 {
+		first, perChunk := idx.stsc[i], idx.stsc[i+1]
+		if first <= prev || uint64(first) > uint64(len(idx.chunks)) || perChunk == 0 {
+			return false
+		}
+		prev = first
+	}
+	for _, o := range idx.chunks {
+		if o >= uint64(size) {
+			return false
+		}
+	}
+	for _, s := range idx.stss {
+		if s == 0 {
+			return false
+		}
+	}
+	return idx.sampleSize > 0 || uint64(len(idx.sizes)) >= idx.samples()
+}
+
+// uint32s returns the big-endian 32-bit integers in b.
+func uint32s(b []byte) []uint32 {
+	var ns []uint32
+	for ; len(b) >= 4; b = b[4:] {
+		ns = append(ns, binary.BigEndian.Uint32(b))
+	}
+	return ns
+}
+
+// seek returns the offset of the last sync sample at or before the time and the time of the sample.
+func (idx *mp4Index) seek(d time.Duration) (int64, time.Duration) {
+	target := uint64(d.Seconds() * float64(idx.timescale))
+
+	// Find the sample at the time.
+	var n, t uint64
+	for i := 0; i+1 < len(idx.stts); i += 2 {
+		count, delta := uint64(idx.stts[i]), uint64(idx.stts[i+1])
+		if delta > 0 && target < t+count*delta {
+			n += (target - t) / delta
+			break
+		}
+		n, t = n+count, t+count*delta
+	}
+
+	if total := idx.samples(); total == 0 {
+		n = 0
+	} else if n >= total {
+		n = total - 1
+	}
+
+	// Back off to the sync sample.
+	if len(idx.stss) > 0 {
+		s := uint64(0)
+		for _, ss := range idx.stss {
+			if uint64(ss) > n+1 {
+				break
+			}
+			s = uint64(ss) - 1
+		}
+		n = s
+	}
+
+	return idx.offset(n), time.Duration(float64(idx.time(n)) / float64(idx.timescale) * float64(time.Second))
+}
+
+// samples returns the number of the samples.
+func (idx *mp4Index) samples() uint64 {
+	var n uint64
+	for i := 0; i+1 < len(idx.stts); i += 2 {
+		n += uint64(idx.stts[i])
+	}
+	return n
+}
+
+// time returns the decoding time of the sample n numbered from 0.
+func (idx *mp4Index) time(n uint64) uint64 {
+	var t uint64
+	for i := 0; i+1 < len(idx.stts); i += 2 {
+		count, delta := uint64(idx.stts[i]), uint64(idx.stts[i+1])
+		if n < count {
+			return t + n*delta
+		}
+		n, t = n-count, t+count*delta
+	}
+	return t
+}
+
+// offset returns the offset of the sample n numbered from 0.
+func (idx *mp4Index) offset(n uint64) int64 {
+	// Find the chunk of the sample and the first sample in it.
+	first := n
+	for i := 0; i+2 < len(idx.stsc); i += 3 {
+		chunk, perChunk := uint64(idx.stsc[i]), uint64(idx.stsc[i+1])
+		next := uint64(len(idx.chunks)) + 1
+		if i+3 < len(idx.stsc) {
+			next = uint64(idx.stsc[i+3])
+		}
+		if perChunk == 0 || next <= chunk {
+			continue
+		}
+		// The last entry runs to the last chunk.
+		if samples := (next - chunk) * perChunk; n >= samples && i+5 < len(idx.stsc) {
+			n -= samples
+			continue
+		}
+		c := chunk + n/perChunk
+		if c > uint64(len(idx.chunks)) {
+			c = uint64(len(idx.chunks))
+		}
+		first -= n % perChunk
+		o := idx.chunks[c-1]
+		for s := first; s < first+n%perChunk; s++ {
+			o += uint64(idx.size(s))
+		}
+		return int64(o)
+	}
+	return int64(idx.chunks[0])
+}
+
+// size returns the size of the sample n numbered from 0.
+func (idx *mp4Index) size(n uint64) uint32 {
+	if idx.sampleSize > 0 {
+		return idx.sampleSize
+	}
+	if n < uint64(len(idx.sizes)) {
+		return idx.sizes[n]
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+)
+
+// box returns an MP4 box of the type with the payload.
+func box(typ string, payload ...[]byte) []byte {
+	b := bytes.Join(payload, nil)
+	var h [8]byte
+	binary.BigEndian.PutUint32(h[:], uint32(8+len(b)))
+	copy(h[4:], typ)
+	return append(h[:], b...)
+}
+
+func TestParseMP4(t *testing.T) {
+	tests := []struct {
+		path string
+		want metadata
+	}{
+		{
+			path: "testdata/h264.mp4",
+			want: metadata{
+				Duration:     5 * time.Second,
+				Width:        320,
+				Height:       240,
+				Channels:     2,
+				SampleRate:   48000,
+				VideoCodec:   "h264",
+				AudioCodec:   "aac",
+				VideoProfile: avcProfileHigh,
+			},
+		},
+		{
+			path: "testdata/tags.m4a",
+			want: metadata{
+				Duration:    5 * time.Second,
+				Channels:    2,
+				SampleRate:  44100,
+				AudioCodec:  "aac",
+				Title:       "Title",
+				Artist:      "Artist",
+				AlbumArtist: "Album Artist",
+				Album:       "Album",
+				Genre:       "Rock",
+				Track:       3,
+				Date:        "2004-05-06",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			b, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var md metadata
+			if err := parseMP4(bytes.NewReader(b), int64(len(b)), &md); err != nil {
+				t.Fatal(err)
+			}
+			if md.Playlist != nil || md.Picture != (picture{}) {
+				t.Errorf("unexpected %+v", md)
+			}
+			if md.Duration != tt.want.Duration ||
+				md.Width != tt.want.Width || md.Height != tt.want.Height ||
+				md.Channels != tt.want.Channels || md.SampleRate != tt.want.SampleRate ||
+				md.VideoCodec != tt.want.VideoCodec || md.AudioCodec != tt.want.AudioCodec || md.VideoProfile != tt.want.VideoProfile ||
+				md.Title != tt.want.Title || md.Artist != tt.want.Artist || md.AlbumArtist != tt.want.AlbumArtist ||
+				md.Album != tt.want.Album || md.Genre != tt.want.Genre || md.Track != tt.want.Track || md.Date != tt.want.Date {
+				t.Errorf("got %+v, want %+v", md, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMP4Tags(t *testing.T) {
+	// item returns an item of the ilst box with a data box of the type.
+	item := func(typ string, dataType uint32, value []byte) []byte {
+		var h [8]byte
+		binary.BigEndian.PutUint32(h[:], dataType)
+		return box(typ, box("data", h[:], value))
+	}
+	ilst := box("ilst",
+		item("\xa9nam", 1, []byte("Title")),
+		item("\xa9gen", 1, []byte("Jazz")),
+		item("trkn", 0, []byte{0, 0, 0, 7, 0, 10, 0, 0}),
+		item("\xa9day", 1, []byte("1999")),
+	)
+	hdlr := box("hdlr", make([]byte, 8), []byte("mdir"), make([]byte, 13))
+	tests := []struct {
+		name string
+		meta []byte
+	}{
+		{name: "ISO meta", meta: box("meta", make([]byte, 4), hdlr, ilst)},
+		// QuickTime files have meta as a plain box.
+		{name: "QuickTime meta", meta: box("meta", hdlr, ilst)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := box("moov", box("udta", tt.meta))
+			var md metadata
+			if err := parseMP4(bytes.NewReader(b), int64(len(b)), &md); err != nil {
+				t.Fatal(err)
+			}
+			if md.Title != "Title" || md.Genre != "Jazz" || md.Track != 7 || md.Date != "1999-01-01" {
+				t.Errorf("got %+v", md)
+			}
+		})
+	}
+}
+
+func TestParseMP4_Malformed(t *testing.T) {
+	trak := func(children ...[]byte) []byte {
+		return box("moov", box("trak", children...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "truncated header", data: []byte{0, 0, 0}},
+		{name: "box larger than file", data: []byte{0, 0, 0, 100, 'm', 'o', 'o', 'v'}},
+		{name: "empty moov", data: box("moov")},
+		{name: "empty mvhd", data: box("moov", box("mvhd"))},
+		{name: "truncated mvhd", data: box("moov", box("mvhd", []byte{1, 0, 0, 0, 0}))},
+		{name: "empty tkhd", data: trak(box("tkhd"), box("mdia", box("hdlr", []byte("\x00\x00\x00\x00\x00\x00\x00\x00vide")), box("minf", box("stbl", box("stsd", make([]byte, 48))))))},
+		{name: "truncated tkhd", data: trak(box("tkhd", []byte{1}), box("mdia", box("hdlr", []byte("\x00\x00\x00\x00\x00\x00\x00\x00vide")), box("minf", box("stbl", box("stsd", make([]byte, 48))))))},
+		{name: "empty hdlr", data: trak(box("mdia", box("hdlr")))},
+		{name: "empty stsd", data: trak(box("mdia", box("hdlr", []byte("\x00\x00\x00\x00\x00\x00\x00\x00soun")), box("minf", box("stbl", box("stsd")))))},
+		{name: "truncated sample entry", data: trak(box("mdia", box("hdlr", []byte("\x00\x00\x00\x00\x00\x00\x00\x00vide")), box("minf", box("stbl", box("stsd", make([]byte, 20))))))},
+		{name: "empty ilst item", data: box("moov", box("udta", box("meta", make([]byte, 4), box("ilst", box("\xa9nam", box("data"))))))},
+		{name: "empty gnre", data: box("moov", box("udta", box("meta", make([]byte, 4), box("ilst", box("gnre", box("data", make([]byte, 8)))))))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			// It must not panic.
+			_ = parseMP4(bytes.NewReader(tt.data), int64(len(tt.data)), &md)
+		})
+	}
+}
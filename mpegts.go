@@ -0,0 +1,397 @@
+package cast
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	// tsClock is the frequency of the PCR base.
+	tsClock = 90000
+	// tsWrap is where the 33-bit PCR base wraps around, about every 26.5 hours.
+	tsWrap = 1 << 33
+	// tsPCRLimit is how far a PCR is looked for. Muxers put one at least every 100 ms.
+	tsPCRLimit = 4 << 20
+)
+
+// mpegTS is an MPEG transport stream, or an M2TS file whose packets have a 4-byte timestamp before each of them.
+type mpegTS struct {
+	r    io.ReaderAt
+	size int64
+	// packetSize is 188 for MPEG-TS and 192 for M2TS.
+	packetSize int64
+	// sync is the offset of the sync byte in a packet.
+	sync int64
+	// pid is the PID of the packets carrying the PCRs. Only the PCRs of the first program are used.
+	pid int
+	// first is the first PCR base.
+	first int64
+	// duration is in 90 kHz ticks.
+	duration int64
+}
+
+// isMPEGTS tells if the file at path is an MPEG transport stream, which mimetype doesn't detect, by its sync bytes.
+func isMPEGTS(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	_, _, ok := tsLayout(f)
+	return ok
+}
+
+// tsLayout returns the packet size and the offset of the sync byte in a packet if r starts with three packets.
+func tsLayout(r io.ReaderAt) (int64, int64, bool) {
+	var b [3*192 + 4]byte
+	n, _ := r.ReadAt(b[:], 0)
+	for _, l := range []struct{ packetSize, sync int64 }{
+		{packetSize: 188, sync: 0},
+		{packetSize: 192, sync: 4},
+	} {
+		ok := true
+		for i := int64(0); i < 3; i++ {
+			if o := l.sync + i*l.packetSize; o >= int64(n) || b[o] != tsSyncByte {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return l.packetSize, l.sync, true
+		}
+	}
+	return 0, 0, false
+}
+
+// newMPEGTS reads the first and the last PCRs of the transport stream.
+func newMPEGTS(r io.ReaderAt, size int64) (*mpegTS, error) {
+	packetSize, sync, ok := tsLayout(r)
+	if !ok {
+		return nil, errMalformed
+	}
+	t := mpegTS{
+		r:          r,
+		size:       size,
+		packetSize: packetSize,
+		sync:       sync,
+		pid:        -1,
+	}
+
+	found := false
+	t.scan(0, tsPCRLimit, func(_ int64, pid int, pcr int64) bool {
+		t.pid, t.first, found = pid, pcr, true
+		return false
+	})
+	if !found {
+		return nil, errMalformed
+	}
+
+	last := t.first
+	t.scan(size-tsPCRLimit, tsPCRLimit, func(_ int64, _ int, pcr int64) bool {
+		last = pcr
+		return true
+	})
+	t.duration = (last - t.first + tsWrap) % tsWrap
+	return &t, nil
+}
+
+// scan calls f with the offset of the packet, the PID and the PCR base for each PCR of t.pid, or of any PID if it's -1,
+// in the packets from offset up to n bytes until f returns false.
+func (t *mpegTS) scan(offset, n int64, f func(offset int64, pid int, pcr int64) bool) {
+	t.packets(offset, n, func(offset int64, p []byte) bool {
+		pid := tsPID(p)
+		if t.pid >= 0 && pid != t.pid {
+			return true
+		}
+		// The adaptation field has the PCR if its flag is set.
+		if p[3]&0x20 == 0 || p[4] < 7 || p[5]&0x10 == 0 {
+			return true
+		}
+		pcr := int64(p[6])<<25 | int64(p[7])<<17 | int64(p[8])<<9 | int64(p[9])<<1 | int64(p[10])>>7
+		return f(offset, pid, pcr)
+	})
+}
+
+// packets calls f with the offset and the 188 bytes from the sync byte of each packet from offset up to n bytes until f returns false.
+func (t *mpegTS) packets(offset, n int64, f func(offset int64, p []byte) bool) {
+	if offset < 0 {
+		n += offset
+		offset = 0
+	}
+	offset -= offset % t.packetSize
+	end := offset + n
+	if end > t.size {
+		end = t.size
+	}
+
+	buf := make([]byte, 256*t.packetSize)
+	for offset < end {
+		l := int64(len(buf))
+		if end-offset < l {
+			l = end - offset
+		}
+		l -= l % t.packetSize
+		if l == 0 {
+			return
+		}
+		if _, err := t.r.ReadAt(buf[:l], offset); err != nil {
+			return
+		}
+		for i := int64(0); i < l; i += t.packetSize {
+			p := buf[i+t.sync : i+t.packetSize]
+			if p[0] != tsSyncByte {
+				continue
+			}
+			if !f(offset+i, p) {
+				return
+			}
+		}
+		offset += l
+	}
+}
+
+// tsPID returns the PID of the packet p.
+func tsPID(p []byte) int {
+	return int(p[1]&0x1f)<<8 | int(p[2])
+}
+
+// tsPayload returns the payload of the packet p, or nil if it has none.
+func tsPayload(p []byte) []byte {
+	if p[3]&0x10 == 0 {
+		return nil
+	}
+	o := 4
+	if p[3]&0x20 != 0 {
+		o += 1 + int(p[4])
+	}
+	if o >= len(p) {
+		return nil
+	}
+	return p[o:]
+}
+
+// tsSection returns the PSI section which starts in the payload, or nil if it's malformed.
+func tsSection(payload []byte) []byte {
+	if len(payload) == 0 || 1+int(payload[0])+3 > len(payload) {
+		return nil
+	}
+	s := payload[1+int(payload[0]):]
+	// The section length is of the bytes after it including the CRC.
+	n := 3 + (int(s[1]&0x0f)<<8 | int(s[2]))
+	if n > len(s) || n < 12 {
+		return nil
+	}
+	return s[:n-4]
+}
+
+// MPEG-TS stream types in PMTs.
+const (
+	tsStreamPrivate = 0x06
+	// tsDescriptorAC3 and tsDescriptorEAC3 tell the codec of DVB private streams.
+	tsDescriptorAC3  = 0x6a
+	tsDescriptorEAC3 = 0x7a
+)
+
+// tsCodecs are the codecs by the stream types.
+var tsCodecs = map[byte]struct {
+	codec string
+	video bool
+}{
+	0x01: {codec: "mpeg1", video: true},
+	0x02: {codec: "mpeg2", video: true},
+	0x1b: {codec: "h264", video: true},
+	0x24: {codec: "hevc", video: true},
+	0x03: {codec: "mp2"},
+	0x04: {codec: "mp2"},
+	0x0f: {codec: "aac"},
+	0x81: {codec: "ac3"},
+	0x87: {codec: "eac3"},
+}
+
+// tsVideoLimit is how much of the video stream is looked into for its sequence header or SPS.
+const tsVideoLimit = 64 << 10
+
+// streams reads the codecs of the first program from its PMT and the profile and the resolution of the video from its sequence header or SPS.
+func (t *mpegTS) streams(md *metadata) {
+	if t.packetSize > tsPacketSize {
+		// Timestamps are valid if any of the first packets has a non-zero one.
+		var b [4 * 192]byte
+		if n, _ := t.r.ReadAt(b[:], 0); n == len(b) {
+			for i := 0; i < 4; i++ {
+				if b[i*192] != 0 || b[i*192+1] != 0 || b[i*192+2] != 0 || b[i*192+3] != 0 {
+					md.TSTimestamped = true
+				}
+			}
+		}
+	}
+	md.TSPacketSize = int(t.packetSize)
+
+	pmt, video := -1, -1
+	var es []byte
+	t.packets(0, tsPCRLimit, func(_ int64, p []byte) bool {
+		pid, start := tsPID(p), p[1]&0x40 != 0
+		switch {
+		case pid == 0 && pmt < 0 && start:
+			pmt = tsPAT(tsSection(tsPayload(p)))
+		case pid == pmt && pmt > 0 && video < 0 && start:
+			s := tsSection(tsPayload(p))
+			if s == nil || s[0] != 0x02 {
+				return true
+			}
+			video = tsPMT(s, md)
+			// The PMT is read only once.
+			pmt = 0
+			return video > 0
+		case pid == video && (start || len(es) > 0):
+			es = append(es, tsPayload(p)...)
+			return !tsVideo(es, md) && len(es) < tsVideoLimit
+		}
+		return true
+	})
+}
+
+// tsPAT returns the PID of the PMT of the first program in the PAT section s, or -1 if there's none.
+func tsPAT(s []byte) int {
+	if s == nil || s[0] != 0x00 {
+		return -1
+	}
+	for b := s[8:]; len(b) >= 4; b = b[4:] {
+		// Program 0 is the network information.
+		if b[0] != 0 || b[1] != 0 {
+			return int(b[2]&0x1f)<<8 | int(b[3])
+		}
+	}
+	return -1
+}
+
+// tsPMT reads the codecs of the first video and audio streams in the PMT section s and returns the PID of the video, or -1 if there's none.
+func tsPMT(s []byte, md *metadata) int {
+	if len(s) < 12 {
+		return -1
+	}
+	video := -1
+	b := s[12:]
+	if n := int(s[10]&0x0f)<<8 | int(s[11]); n <= len(b) {
+		b = b[n:]
+	} else {
+		return -1
+	}
+	for len(b) >= 5 {
+		typ, pid, n := b[0], int(b[1]&0x1f)<<8|int(b[2]), int(b[3]&0x0f)<<8|int(b[4])
+		if 5+n > len(b) {
+			break
+		}
+		c, ok := tsCodecs[typ]
+		if typ == tsStreamPrivate {
+			// DVB tells the codec of AC-3 in the descriptors.
+			for d := b[5 : 5+n]; len(d) >= 2 && 2+int(d[1]) <= len(d); d = d[2+int(d[1]):] {
+				switch d[0] {
+				case tsDescriptorAC3:
+					c, ok = tsCodecs[0x81], true
+				case tsDescriptorEAC3:
+					c, ok = tsCodecs[0x87], true
+				}
+			}
+		}
+		switch {
+		case !ok:
+		case c.video && video < 0:
+			md.VideoCodec, video = c.codec, pid
+		case !c.video && md.AudioCodec == "":
+			md.AudioCodec = c.codec
+		}
+		b = b[5+n:]
+	}
+	return video
+}
+
+// tsVideo reads the resolution, and the profile of H.264, from the sequence header or the SPS in the start of the video stream es.
+// It returns false if they're not found yet.
+func tsVideo(es []byte, md *metadata) bool {
+	for i := 0; i+4 <= len(es); i++ {
+		if es[i] != 0 || es[i+1] != 0 || es[i+2] != 1 {
+			continue
+		}
+		b := es[i+3:]
+		switch md.VideoCodec {
+		case "mpeg1", "mpeg2":
+			if b[0] == 0xb3 && len(b) >= 4 {
+				md.Width, md.Height = int(b[1])<<4|int(b[2])>>4, int(b[2]&0x0f)<<8|int(b[3])
+				return true
+			}
+		case "h264":
+			if b[0]&0x1f != h264NALSPS {
+				continue
+			}
+			// The SPS ends at the next start code.
+			end := len(b)
+			for j := 1; j+3 <= len(b); j++ {
+				if b[j] == 0 && b[j+1] == 0 && b[j+2] <= 1 {
+					end = j
+					break
+				}
+			}
+			if end == len(b) {
+				return false
+			}
+			return parseSPS(b[:end], md) == nil
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// elapsed returns the time of the PCR from the first one in 90 kHz ticks.
+func (t *mpegTS) elapsed(pcr int64) int64 {
+	return (pcr - t.first + tsWrap) % tsWrap
+}
+
+// seek returns the offset of the packet with the last PCR at or before the time and the time of the PCR.
+// It bisects the file by the offsets assuming that the PCRs increase monotonically.
+func (t *mpegTS) seek(d time.Duration) (int64, time.Duration) {
+	target := int64(d / (time.Second / tsClock))
+	var (
+		lo, loTicks int64
+		hi          = t.size
+	)
+	for hi-lo > 64*t.packetSize {
+		mid := lo + (hi-lo)/2
+		mid -= mid % t.packetSize
+		found := false
+		t.scan(mid, hi-mid, func(offset int64, _ int, pcr int64) bool {
+			if e := t.elapsed(pcr); e <= target {
+				lo, loTicks, found = offset, e, true
+			}
+			return false
+		})
+		if !found {
+			hi = mid
+		}
+	}
+	t.scan(lo, hi-lo, func(offset int64, _ int, pcr int64) bool {
+		if e := t.elapsed(pcr); e <= target {
+			lo, loTicks = offset, e
+		}
+		return true
+	})
+	return lo, time.Duration(loTicks) * time.Second / tsClock
+}
+
+// parseMPEGTS reads the duration of a transport stream from its first and last PCRs, and its codecs and resolution.
+func parseMPEGTS(r io.ReaderAt, size int64, md *metadata) error {
+	t, err := newMPEGTS(r, size)
+	if err != nil {
+		return err
+	}
+	md.Duration = time.Duration(t.duration) * time.Second / tsClock
+	md.TimeSeekable = true
+	t.streams(md)
+	return nil
+}
@@ -0,0 +1,127 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseMPEGTS(t *testing.T) {
+	ts, err := os.ReadFile("testdata/h264.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamped := m2ts(ts)
+	for i := 0; i < len(timestamped); i += 192 {
+		timestamped[i+3] = byte(i / 192)
+	}
+
+	// The SPS of the video straddles two packets.
+	tests := []struct {
+		name    string
+		data    []byte
+		want    metadata
+		profile string
+	}{
+		{
+			name:    "MPEG-TS",
+			data:    ts,
+			want:    metadata{TSPacketSize: 188},
+			profile: "AVC_TS_MP_HD_AAC_MULT5_ISO",
+		},
+		{
+			name:    "M2TS with zero timestamps",
+			data:    m2ts(ts),
+			want:    metadata{TSPacketSize: 192},
+			profile: "AVC_TS_MP_HD_AAC_MULT5",
+		},
+		{
+			name:    "M2TS with timestamps",
+			data:    timestamped,
+			want:    metadata{TSPacketSize: 192, TSTimestamped: true},
+			profile: "AVC_TS_MP_HD_AAC_MULT5_T",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			if err := parseMPEGTS(bytes.NewReader(tt.data), int64(len(tt.data)), &md); err != nil {
+				t.Fatal(err)
+			}
+			if md.Duration != 2*time.Second || md.VideoCodec != "h264" || md.AudioCodec != "aac" ||
+				md.VideoProfile != avcProfileMain || md.Width != 1280 || md.Height != 720 ||
+				md.TSPacketSize != tt.want.TSPacketSize || md.TSTimestamped != tt.want.TSTimestamped {
+				t.Errorf("got %+v", md)
+			}
+			if got := dlnaProfile("video/mp2t", &md); got != tt.profile {
+				t.Errorf("got %s, want %s", got, tt.profile)
+			}
+		})
+	}
+}
+
+func TestTSPMT(t *testing.T) {
+	// pmt returns a PMT section, without the CRC, of the streams after the PCR PID and the program info length.
+	pmt := func(streams string) []byte {
+		b, err := hex.DecodeString("02b0000001c10000e100f000" + streams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	tests := []struct {
+		name       string
+		section    []byte
+		video      int
+		videoCodec string
+		audioCodec string
+	}{
+		{name: "H.264 and AAC", section: pmt("1be100f0000fe101f000"), video: 0x100, videoCodec: "h264", audioCodec: "aac"},
+		{name: "MPEG-2 and AC-3", section: pmt("02e100f00081e101f000"), video: 0x100, videoCodec: "mpeg2", audioCodec: "ac3"},
+		{name: "DVB AC-3", section: pmt("1be100f00006e101f0030a01ff06e102f0036a0100"), video: 0x100, videoCodec: "h264", audioCodec: "ac3"},
+		{name: "DVB E-AC-3", section: pmt("1be100f00006e101f0027a00"), video: 0x100, videoCodec: "h264", audioCodec: "eac3"},
+		{name: "first audio", section: pmt("03e101f0000fe102f0001be100f000"), video: 0x100, videoCodec: "h264", audioCodec: "mp2"},
+		{name: "audio only", section: pmt("0fe101f000"), video: -1, audioCodec: "aac"},
+		{name: "truncated descriptors", section: pmt("1be100f005"), video: -1},
+		{name: "truncated", section: []byte{0x02, 0xb0}, video: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			if video := tsPMT(tt.section, &md); video != tt.video || md.VideoCodec != tt.videoCodec || md.AudioCodec != tt.audioCodec {
+				t.Errorf("got %d %+v", video, md)
+			}
+		})
+	}
+}
+
+func TestTSVideo(t *testing.T) {
+	tests := []struct {
+		name          string
+		codec         string
+		es            string
+		ok            bool
+		width, height int
+	}{
+		{name: "MPEG-2 sequence header", codec: "mpeg2", es: "000001e0000080800521000100010000" + "01b32d0240", ok: true, width: 720, height: 576},
+		{name: "MPEG-2 without sequence header", codec: "mpeg2", es: "000001b52d02", ok: false},
+		{name: "H.264 SPS", codec: "h264", es: "0000000109f000000001674d401fed00a00b7200000001", ok: true, width: 1280, height: 720},
+		{name: "H.264 SPS not ended yet", codec: "h264", es: "0000000109f000000001674d401fed00a0", ok: false},
+		{name: "H.264 malformed SPS", codec: "h264", es: "00000001674d401f000000000001", ok: false},
+		{name: "other codec", codec: "hevc", es: "0000000140", ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es, err := hex.DecodeString(tt.es)
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := metadata{VideoCodec: tt.codec}
+			if ok := tsVideo(es, &md); ok != tt.ok || md.Width != tt.width || md.Height != tt.height {
+				t.Errorf("got %t %dx%d, want %t %dx%d", ok, md.Width, md.Height, tt.ok, tt.width, tt.height)
+			}
+		})
+	}
+}
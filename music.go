@@ -0,0 +1,123 @@
+package cast
+
+import (
+	"sort"
+	"strings"
+)
+
+// musicID is the object ID of the virtual container which contains the views of music tracks by their tags.
+var musicID = virtualID("music")
+
+// addMusic adds the virtual containers of the tracks by artist, album and genre to children.
+// Artists and albums have the cover art of their first tracks which have any.
+// The tracks are listed in albums by their track numbers and elsewhere by album and track number.
+// Albums of the same name by different album artists are different albums.
+// Nothing is added if there are no tracks.
+func addMusic(children map[string]MediaItems, tracks MediaItems) {
+	if len(tracks) == 0 {
+		return
+	}
+
+	tracks = append(MediaItems(nil), tracks...)
+	sort.SliceStable(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if a.Album != b.Album {
+			return lessName(a.Album, b.Album)
+		}
+		return a.OriginalTrackNumber < b.OriginalTrackNumber
+	})
+
+	var (
+		artistsID = virtualID("music", "artists")
+		albumsID  = virtualID("music", "albums")
+		genresID  = virtualID("music", "genres")
+	)
+	children[rootID] = append(children[rootID], container(musicID, rootID, "Music", MediaClassContainer))
+	children[musicID] = MediaItems{
+		container(artistsID, musicID, "Artists", MediaClassContainer),
+		container(albumsID, musicID, "Albums", MediaClassContainer),
+		container(genresID, musicID, "Genres", MediaClassContainer),
+	}
+
+	for _, g := range groupBy(tracks, func(i MediaItem) string { return i.Artist }) {
+		artist := container(objectID(artistsID, g.name), artistsID, g.name, MediaClassMusicArtist)
+		artist.AlbumArt = firstArt(g.items)
+		children[artistsID] = append(children[artistsID], artist)
+		for _, a := range groupBy(g.items, func(i MediaItem) string { return i.Album }) {
+			album := container(objectID(artist.ID, a.name), artist.ID, a.name, MediaClassMusicAlbum)
+			album.Artist = g.name
+			album.AlbumArt = firstArt(a.items)
+			children[artist.ID] = append(children[artist.ID], album)
+			addRefs(children, album.ID, a.items)
+		}
+		// Tracks without albums are listed right under their artists.
+		for _, t := range g.items {
+			if t.Album == "" {
+				children[artist.ID] = append(children[artist.ID], ref(t, artist.ID))
+			}
+		}
+	}
+	albumKey := func(i MediaItem) string {
+		if i.Album == "" {
+			return ""
+		}
+		return i.Album + "\x00" + i.albumArtist
+	}
+	for _, g := range groupBy(tracks, albumKey) {
+		album := container(objectID(albumsID, g.name), albumsID, g.items[0].Album, MediaClassMusicAlbum)
+		album.Artist = g.items[0].albumArtist
+		album.AlbumArt = firstArt(g.items)
+		children[albumsID] = append(children[albumsID], album)
+		addRefs(children, album.ID, g.items)
+	}
+	for _, g := range groupBy(tracks, func(i MediaItem) string { return i.Genre }) {
+		genre := container(objectID(genresID, g.name), genresID, g.name, MediaClassMusicGenre)
+		children[genresID] = append(children[genresID], genre)
+		addRefs(children, genre.ID, g.items)
+	}
+}
+
+// addRefs adds references to the items to the container parentID.
+func addRefs(children map[string]MediaItems, parentID string, items MediaItems) {
+	for _, i := range items {
+		children[parentID] = append(children[parentID], ref(i, parentID))
+	}
+}
+
+// itemGroup is a named group of items.
+type itemGroup struct {
+	name  string
+	items MediaItems
+}
+
+// groupBy groups the items by their keys in the order of the keys. Items keep their order in the groups.
+// Items with empty keys are left out.
+func groupBy(items MediaItems, key func(MediaItem) string) []itemGroup {
+	index := map[string]int{}
+	var groups []itemGroup
+	for _, i := range items {
+		k := key(i)
+		if k == "" {
+			continue
+		}
+		n, ok := index[k]
+		if !ok {
+			n = len(groups)
+			index[k] = n
+			groups = append(groups, itemGroup{name: k})
+		}
+		groups[n].items = append(groups[n].items, i)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return lessName(groups[i].name, groups[j].name)
+	})
+	return groups
+}
+
+// lessName compares names case-insensitively and then case-sensitively for the names which only differ in cases.
+func lessName(a, b string) bool {
+	if la, lb := strings.ToLower(a), strings.ToLower(b); la != lb {
+		return la < lb
+	}
+	return a < b
+}
@@ -0,0 +1,53 @@
+package cast
+
+import "testing"
+
+func TestAddMusic_Albums(t *testing.T) {
+	tracks := MediaItems{
+		{ID: "1", Title: "A", Artist: "Queen", albumArtist: "Queen", Album: "Greatest Hits", OriginalTrackNumber: 2},
+		{ID: "2", Title: "B", Artist: "ABBA", albumArtist: "ABBA", Album: "Greatest Hits", OriginalTrackNumber: 1},
+		{ID: "3", Title: "C", Artist: "Queen", albumArtist: "Queen", Album: "Greatest Hits", OriginalTrackNumber: 1},
+		// A compilation of tracks by different artists is an album of its album artist.
+		{ID: "4", Title: "D", Artist: "Queen", albumArtist: "Various Artists", Album: "Hits of the 70s", OriginalTrackNumber: 1},
+		{ID: "5", Title: "E", Artist: "ABBA", albumArtist: "Various Artists", Album: "Hits of the 70s", OriginalTrackNumber: 2},
+		{ID: "6", Title: "F", Artist: "ABBA", albumArtist: "ABBA"},
+	}
+	children := map[string]MediaItems{}
+	addMusic(children, tracks)
+
+	albums := children[virtualID("music", "albums")]
+	want := []struct {
+		title, artist string
+		tracks        []string
+	}{
+		{title: "Greatest Hits", artist: "ABBA", tracks: []string{"2"}},
+		{title: "Greatest Hits", artist: "Queen", tracks: []string{"3", "1"}},
+		{title: "Hits of the 70s", artist: "Various Artists", tracks: []string{"4", "5"}},
+	}
+	if len(albums) != len(want) {
+		t.Fatalf("got %d albums, want %d", len(albums), len(want))
+	}
+	for i, w := range want {
+		a := albums[i]
+		if a.Title != w.title || a.Artist != w.artist || a.Class != MediaClassMusicAlbum {
+			t.Errorf("got %s by %s, want %s by %s", a.Title, a.Artist, w.title, w.artist)
+		}
+		var got []string
+		for _, c := range children[a.ID] {
+			got = append(got, c.RefID)
+		}
+		if len(got) != len(w.tracks) {
+			t.Errorf("got %q, want %q", got, w.tracks)
+			continue
+		}
+		for j := range got {
+			if got[j] != w.tracks[j] {
+				t.Errorf("got %q, want %q", got, w.tracks)
+				break
+			}
+		}
+	}
+	if albums[0].ID == albums[1].ID {
+		t.Error("albums of the same name have the same ID")
+	}
+}
@@ -0,0 +1,139 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// oggHeaderLimit is the maximum number of bytes read to find the header packets of an Ogg stream.
+const oggHeaderLimit = 1 << 20
+
+// oggPacketLimit is the maximum size of a header packet. Larger comments, e.g. with embedded pictures, are cut off.
+const oggPacketLimit = 256 << 10
+
+// parseOgg reads the stream properties and the comments of the first logical stream of an Ogg Vorbis or Opus file.
+func parseOgg(r io.ReaderAt, size int64, md *metadata) error {
+	var (
+		packets [][]byte
+		packet  []byte
+		serial  uint32
+		offset  int64
+	)
+	for offset < size && offset < oggHeaderLimit && len(packets) < 2 {
+		h, segs, err := oggPage(r, offset)
+		if err != nil {
+			return err
+		}
+		s := binary.LittleEndian.Uint32(h[14:])
+		if offset == 0 {
+			serial = s
+		}
+		offset += int64(len(h) + len(segs))
+		var n int64
+		for _, l := range segs {
+			n += int64(l)
+		}
+		if s != serial {
+			offset += n
+			continue
+		}
+
+		data := make([]byte, n)
+		if _, err := r.ReadAt(data, offset); err != nil {
+			return err
+		}
+		offset += n
+		for _, l := range segs {
+			if len(packet) < oggPacketLimit {
+				packet = append(packet, data[:l]...)
+			}
+			data = data[l:]
+			if l < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	if len(packets) < 1 {
+		return errMalformed
+	}
+
+	var (
+		preSkip uint64
+		// rate is the unit of the granule positions.
+		rate int
+	)
+	switch head := packets[0]; {
+	case len(head) >= 16 && bytes.HasPrefix(head, []byte("\x01vorbis")):
+		md.Channels = int(head[11])
+		md.SampleRate = int(binary.LittleEndian.Uint32(head[12:]))
+		rate = md.SampleRate
+	case len(head) >= 16 && bytes.HasPrefix(head, []byte("OpusHead")):
+		md.Channels = int(head[9])
+		preSkip = uint64(binary.LittleEndian.Uint16(head[10:]))
+		md.SampleRate = int(binary.LittleEndian.Uint32(head[12:]))
+		// Opus is always decoded at 48kHz regardless of the sample rate of the original input.
+		rate = 48000
+		if md.SampleRate == 0 {
+			md.SampleRate = rate
+		}
+	default:
+		return errMalformed
+	}
+
+	if len(packets) > 1 {
+		switch c := packets[1]; {
+		case bytes.HasPrefix(c, []byte("\x03vorbis")):
+			parseVorbisComment(c[7:], md)
+		case bytes.HasPrefix(c, []byte("OpusTags")):
+			parseVorbisComment(c[8:], md)
+		}
+	}
+
+	if granule, ok := oggLastGranule(r, size, serial); ok && rate > 0 && granule > preSkip {
+		md.Duration = time.Duration(granule-preSkip) * time.Second / time.Duration(rate)
+	}
+	return nil
+}
+
+// oggPage reads the header and the segment table of the page at offset.
+func oggPage(r io.ReaderAt, offset int64) ([]byte, []byte, error) {
+	h := make([]byte, 27)
+	if _, err := r.ReadAt(h, offset); err != nil {
+		return nil, nil, err
+	}
+	if string(h[:4]) != "OggS" {
+		return nil, nil, errMalformed
+	}
+	segs := make([]byte, h[26])
+	if _, err := r.ReadAt(segs, offset+27); err != nil {
+		return nil, nil, err
+	}
+	return h, segs, nil
+}
+
+// oggLastGranule finds the granule position of the last page of the logical stream at the end of the file.
+func oggLastGranule(r io.ReaderAt, size int64, serial uint32) (uint64, bool) {
+	const tail = 64 << 10
+	offset := size - tail
+	if offset < 0 {
+		offset = 0
+	}
+	b := make([]byte, size-offset)
+	if _, err := r.ReadAt(b, offset); err != nil && err != io.EOF {
+		return 0, false
+	}
+	for i := bytes.LastIndex(b, []byte("OggS")); i >= 0; i = bytes.LastIndex(b[:i], []byte("OggS")) {
+		if len(b)-i < 27 || binary.LittleEndian.Uint32(b[i+14:]) != serial {
+			continue
+		}
+		g := binary.LittleEndian.Uint64(b[i+6:])
+		if g == ^uint64(0) {
+			continue
+		}
+		return g, true
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+package cast
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseOgg(t *testing.T) {
+	tests := []struct {
+		path string
+		want metadata
+	}{
+		{
+			// The comments span segments and the file has another logical stream whose pages are skipped.
+			path: "testdata/tags.ogg",
+			want: metadata{
+				Duration:   10 * time.Second,
+				Channels:   2,
+				SampleRate: 44100,
+				Title:      "Title",
+				Artist:     "Artist",
+				Album:      "Album",
+				Track:      3,
+				Date:       "2004-01-01",
+			},
+		},
+		{
+			// The duration excludes the pre-skip and the sample rate is of the original input.
+			path: "testdata/tags.opus",
+			want: metadata{
+				Duration:    5 * time.Second,
+				Channels:    2,
+				SampleRate:  44100,
+				Title:       "Title",
+				Artist:      "Artist",
+				AlbumArtist: "Album Artist",
+				Album:       "Album",
+				Genre:       "Rock",
+				Track:       3,
+				Date:        "2004-05-01",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			b, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var md metadata
+			if err := parseOgg(bytes.NewReader(b), int64(len(b)), &md); err != nil {
+				t.Fatal(err)
+			}
+			if md.Duration != tt.want.Duration || md.Channels != tt.want.Channels || md.SampleRate != tt.want.SampleRate ||
+				md.Title != tt.want.Title || md.Artist != tt.want.Artist || md.AlbumArtist != tt.want.AlbumArtist ||
+				md.Album != tt.want.Album || md.Genre != tt.want.Genre || md.Track != tt.want.Track || md.Date != tt.want.Date {
+				t.Errorf("got %+v, want %+v", md, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOgg_Malformed(t *testing.T) {
+	b, err := os.ReadFile("testdata/tags.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first packet is neither of Vorbis nor Opus.
+	other := append([]byte(nil), b...)
+	copy(other[28:], "\x01theora")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not Ogg", data: []byte("fLaC\x00\x00\x00\x22")},
+		{name: "no packets", data: b[:27]},
+		{name: "other codec", data: other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			if err := parseOgg(bytes.NewReader(tt.data), int64(len(tt.data)), &md); err == nil {
+				t.Errorf("got %+v", md)
+			}
+		})
+	}
+}
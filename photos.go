@@ -0,0 +1,48 @@
+package cast
+
+import (
+	"sort"
+)
+
+// photosID is the object ID of the virtual container which contains the images by the year and the month when they were taken.
+var photosID = virtualID("photos")
+
+// addPhotos adds the virtual containers of the images by year and month to children.
+// Images are dated by their EXIF or, if they have none, by their modification time.
+// Years and months are listed newest first while the images in a month are listed oldest first.
+// Nothing is added if there are no images.
+func addPhotos(children map[string]MediaItems, images MediaItems) {
+	if len(images) == 0 {
+		return
+	}
+
+	images = append(MediaItems(nil), images...)
+	sort.SliceStable(images, func(i, j int) bool {
+		return takenAt(images[i]) < takenAt(images[j])
+	})
+
+	children[rootID] = append(children[rootID], container(photosID, rootID, "Photos by Date", MediaClassContainer))
+
+	years := groupBy(images, func(i MediaItem) string { return takenAt(i)[:4] })
+	for i := len(years) - 1; i >= 0; i-- {
+		y := years[i]
+		year := container(objectID(photosID, y.name), photosID, y.name, MediaClassContainer)
+		children[photosID] = append(children[photosID], year)
+
+		months := groupBy(y.items, func(i MediaItem) string { return takenAt(i)[:7] })
+		for j := len(months) - 1; j >= 0; j-- {
+			m := months[j]
+			month := container(objectID(year.ID, m.name), year.ID, m.name, MediaClassPhotoAlbum)
+			children[year.ID] = append(children[year.ID], month)
+			addRefs(children, month.ID, m.items)
+		}
+	}
+}
+
+// takenAt returns the date when the image was taken in the form of YYYY-MM-DD, optionally followed by THH:MM:SS.
+func takenAt(i MediaItem) string {
+	if len(i.Date) >= len("2006-01-02") {
+		return i.Date
+	}
+	return i.modTime.Format("2006-01-02T15:04:05")
+}
@@ -0,0 +1,95 @@
+package cast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddPhotos(t *testing.T) {
+	images := MediaItems{
+		{ID: "1", Title: "1.jpg", Date: "2019-05-06T12:00:00"},
+		{ID: "2", Title: "2.jpg", Date: "2021-01-02"},
+		{ID: "3", Title: "3.jpg", Date: "2019-05-01T08:00:00"},
+		// Images without EXIF dates are dated by their modification time.
+		{ID: "4", Title: "4.jpg", modTime: time.Date(2019, 12, 24, 18, 0, 0, 0, time.UTC)},
+		{ID: "5", Title: "5.jpg", Date: "2019", modTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "6", Title: "6.jpg", Date: "2019-05-06T09:00:00"},
+	}
+	children := map[string]MediaItems{}
+	addPhotos(children, images)
+
+	if got := children[rootID]; len(got) != 1 || got[0].ID != photosID {
+		t.Fatalf("got %+v", got)
+	}
+	// Years and months are newest first and the images in a month are oldest first.
+	want := []struct {
+		year   string
+		months []string
+		images [][]string
+	}{
+		{year: "2021", months: []string{"2021-01"}, images: [][]string{{"5", "2"}}},
+		{year: "2019", months: []string{"2019-12", "2019-05"}, images: [][]string{{"4"}, {"3", "6", "1"}}},
+	}
+	years := children[photosID]
+	if len(years) != len(want) {
+		t.Fatalf("got %d years, want %d", len(years), len(want))
+	}
+	for i, w := range want {
+		if years[i].Title != w.year {
+			t.Errorf("got %s, want %s", years[i].Title, w.year)
+		}
+		months := children[years[i].ID]
+		if len(months) != len(w.months) {
+			t.Errorf("%s: got %d months, want %d", w.year, len(months), len(w.months))
+			continue
+		}
+		for j, m := range months {
+			if m.Title != w.months[j] || m.Class != MediaClassPhotoAlbum {
+				t.Errorf("got %s, want %s", m.Title, w.months[j])
+			}
+			var got []string
+			for _, i := range children[m.ID] {
+				got = append(got, i.RefID)
+			}
+			if len(got) != len(w.images[j]) {
+				t.Errorf("%s: got %q, want %q", m.Title, got, w.images[j])
+				continue
+			}
+			for k := range got {
+				if got[k] != w.images[j][k] {
+					t.Errorf("%s: got %q, want %q", m.Title, got, w.images[j])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestAddPhotos_Empty(t *testing.T) {
+	children := map[string]MediaItems{}
+	addPhotos(children, nil)
+	if len(children) != 0 {
+		t.Errorf("got %+v", children)
+	}
+}
+
+func TestTakenAt(t *testing.T) {
+	modTime := time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)
+	tests := []struct {
+		name string
+		date string
+		want string
+	}{
+		{name: "EXIF date and time", date: "2004-05-06T12:34:56", want: "2004-05-06T12:34:56"},
+		{name: "date", date: "2004-05-06", want: "2004-05-06"},
+		{name: "year only", date: "2004", want: "2020-02-03T04:05:06"},
+		{name: "none", want: "2020-02-03T04:05:06"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := takenAt(MediaItem{Date: tt.date, modTime: modTime}); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package cast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// playlistTypes are the MIME types of playlist files by their extensions since they can't be told by their content.
+var playlistTypes = map[string]string{
+	".m3u":  "audio/x-mpegurl",
+	".m3u8": "audio/x-mpegurl",
+	".pls":  "audio/x-scpls",
+	".xspf": "application/xspf+xml",
+}
+
+// playlistLimit is the maximum size of a playlist file.
+const playlistLimit = 4 << 20
+
+// playlistEntry is an entry of a playlist.
+type playlistEntry struct {
+	// Location is either a path, which is relative to the playlist file unless it's absolute, or a URL.
+	Location string
+	Title    string
+}
+
+// readPlaylist reads the content of a playlist file as UTF-8.
+func readPlaylist(r io.ReaderAt, size int64) ([]byte, error) {
+	if size > playlistLimit {
+		return nil, errMalformed
+	}
+	b := make([]byte, size)
+	if _, err := r.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(b) {
+		b = []byte(latin1(b))
+	}
+	return b, nil
+}
+
+// parseM3U reads the entries of an M3U or M3U8 playlist.
+func parseM3U(r io.ReaderAt, size int64, md *metadata) error {
+	b, err := readPlaylist(r, size)
+	if err != nil {
+		return err
+	}
+
+	var title string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			// #EXTINF:duration,title
+			if i := strings.Index(line, ","); i >= 0 {
+				title = strings.TrimSpace(line[i+1:])
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			md.Playlist = append(md.Playlist, playlistEntry{Location: line, Title: title})
+			title = ""
+		}
+	}
+	return s.Err()
+}
+
+// parsePLS reads the entries of a PLS playlist.
+func parsePLS(r io.ReaderAt, size int64, md *metadata) error {
+	b, err := readPlaylist(r, size)
+	if err != nil {
+		return err
+	}
+
+	entries := map[int]*playlistEntry{}
+	entry := func(n int) *playlistEntry {
+		e, ok := entries[n]
+		if !ok {
+			e = &playlistEntry{}
+			entries[n] = e
+		}
+		return e
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(line[:i])), strings.TrimSpace(line[i+1:])
+		switch {
+		case strings.HasPrefix(key, "file"):
+			if n, err := strconv.Atoi(key[len("file"):]); err == nil {
+				entry(n).Location = value
+			}
+		case strings.HasPrefix(key, "title"):
+			if n, err := strconv.Atoi(key[len("title"):]); err == nil {
+				entry(n).Title = value
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	ns := make([]int, 0, len(entries))
+	for n := range entries {
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+	for _, n := range ns {
+		if e := entries[n]; e.Location != "" {
+			md.Playlist = append(md.Playlist, *e)
+		}
+	}
+	return nil
+}
+
+// parseXSPF reads the entries of an XSPF playlist.
+func parseXSPF(r io.ReaderAt, size int64, md *metadata) error {
+	if size > playlistLimit {
+		return errMalformed
+	}
+	var p struct {
+		Tracks []struct {
+			Locations []string `xml:"location"`
+			Title     string   `xml:"title"`
+		} `xml:"trackList>track"`
+	}
+	if err := xml.NewDecoder(io.NewSectionReader(r, 0, size)).Decode(&p); err != nil {
+		return err
+	}
+	for _, t := range p.Tracks {
+		if len(t.Locations) == 0 {
+			continue
+		}
+		// Locations are URIs, which are relative to the playlist file unless they're absolute.
+		loc := strings.TrimSpace(t.Locations[0])
+		if u, err := url.Parse(loc); err == nil && u.Scheme == "" {
+			loc = u.Path
+		}
+		md.Playlist = append(md.Playlist, playlistEntry{Location: loc, Title: strings.TrimSpace(t.Title)})
+	}
+	return nil
+}
+
+// playlist is a playlist file in the library.
+type playlist struct {
+	item    MediaItem
+	dir     string
+	entries []playlistEntry
+}
+
+// addPlaylists fills the playlist containers with references to the items in files or, for remote entries, external items.
+// Entries pointing to files which aren't published are left out, and so are the playlists left empty.
+func addPlaylists(children map[string]MediaItems, playlists []playlist, files MediaItems) {
+	if len(playlists) == 0 {
+		return
+	}
+
+	byPath := make(map[string]MediaItem, len(files))
+	for _, i := range files {
+		byPath[i.path] = i
+	}
+
+	for _, p := range playlists {
+		for n, e := range p.entries {
+			id := objectID(p.item.ID, strconv.Itoa(n))
+			if u, err := url.Parse(e.Location); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				children[p.item.ID] = append(children[p.item.ID], external(id, p.item.ID, u, e.Title))
+				continue
+			}
+
+			i, ok := byPath[resolve(p.dir, e.Location)]
+			if !ok {
+				log.WithFields(log.Fields{
+					"playlist": p.item.Title,
+					"location": e.Location,
+				}).Debug("Skip unknown playlist entry.")
+				continue
+			}
+			r := ref(i, p.item.ID)
+			r.ID = id
+			children[p.item.ID] = append(children[p.item.ID], r)
+		}
+		if len(children[p.item.ID]) == 0 {
+			log.WithField("playlist", p.item.Title).Debug("Skip empty playlist.")
+			removeChild(children, p.item.ParentID, p.item.ID)
+		}
+	}
+}
+
+// removeChild removes the object id from the children of the container parentID.
+func removeChild(children map[string]MediaItems, parentID, id string) {
+	items := children[parentID][:0]
+	for _, i := range children[parentID] {
+		if i.ID != id {
+			items = append(items, i)
+		}
+	}
+	children[parentID] = items
+}
+
+// resolve returns the path of the file at the location of a playlist entry in dir.
+func resolve(dir, loc string) string {
+	if u, err := url.Parse(loc); err == nil && u.Scheme == "file" {
+		return filepath.Clean(filepath.FromSlash(u.Path))
+	}
+	// Playlists made on Windows have backslash-separated paths.
+	p := filepath.FromSlash(strings.ReplaceAll(loc, `\`, "/"))
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	return filepath.Clean(p)
+}
+
+// external returns an item of the resource at the remote URL u.
+func external(id, parentID string, u *url.URL, title string) MediaItem {
+	t := mime.TypeByExtension(path.Ext(u.Path))
+	if t == "" {
+		t = "*"
+	}
+	if i := strings.Index(t, ";"); i >= 0 {
+		t = t[:i]
+	}
+	if title == "" {
+		title = u.String()
+	}
+	// Remote audio and videos are most likely internet radio and live streams.
+	c := (&entry{MIME: t}).class()
+	switch {
+	case c.DerivedFrom(MediaClassAudioItem.String()):
+		c = MediaClassAudioBroadcast
+	case c.DerivedFrom(MediaClassVideoItem.String()):
+		c = MediaClassVideoBroadcast
+	}
+	return MediaItem{
+		ID:           id,
+		ParentID:     parentID,
+		Title:        title,
+		Class:        c,
+		ProtocolInfo: "http-get:*:" + t + ":*",
+		URL:          u,
+	}
+}
@@ -0,0 +1,184 @@
+package cast
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParsePlaylists(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(r io.ReaderAt, size int64, md *metadata) error
+		data  string
+		want  []playlistEntry
+	}{
+		{
+			name:  "M3U",
+			parse: parseM3U,
+			data:  "\xef\xbb\xbf#EXTM3U\r\n#EXTINF:123, Artist - Title\r\nmusic/a.mp3\r\n\r\n# comment\r\n  b.mp3  \r\n#EXTINF:-1,Radio\r\nhttp://example.com/stream\r\n",
+			want: []playlistEntry{
+				{Location: "music/a.mp3", Title: "Artist - Title"},
+				{Location: "b.mp3"},
+				{Location: "http://example.com/stream", Title: "Radio"},
+			},
+		},
+		{
+			name:  "M3U in Latin-1",
+			parse: parseM3U,
+			data:  "#EXTINF:1,Caf\xe9\nCaf\xe9.mp3\n",
+			want:  []playlistEntry{{Location: "Café.mp3", Title: "Café"}},
+		},
+		{
+			name:  "PLS",
+			parse: parsePLS,
+			data:  "[playlist]\nFile2=b.mp3\nTitle2=B\nfile1 = a.mp3\nTitle3=No file\nFileX=x.mp3\nNumberOfEntries=2\nVersion=2\n",
+			want:  []playlistEntry{{Location: "a.mp3"}, {Location: "b.mp3", Title: "B"}},
+		},
+		{
+			name:  "XSPF",
+			parse: parseXSPF,
+			data: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track><location>music/a%20b.mp3</location><title> A </title></track>
+    <track><location>file:///srv/music/c.mp3</location></track>
+    <track><location>http://example.com/stream</location><location>http://example.com/other</location></track>
+    <track><title>No location</title></track>
+  </trackList>
+</playlist>`,
+			want: []playlistEntry{
+				{Location: "music/a b.mp3", Title: "A"},
+				{Location: "file:///srv/music/c.mp3"},
+				{Location: "http://example.com/stream"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			if err := tt.parse(bytes.NewReader([]byte(tt.data)), int64(len(tt.data)), &md); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(md.Playlist, tt.want) {
+				t.Errorf("got %+v, want %+v", md.Playlist, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePlaylists_TooLarge(t *testing.T) {
+	for _, parse := range []func(r io.ReaderAt, size int64, md *metadata) error{parseM3U, parsePLS, parseXSPF} {
+		var md metadata
+		if err := parse(bytes.NewReader(nil), playlistLimit+1, &md); err != errMalformed {
+			t.Errorf("got %v, want %v", err, errMalformed)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := filepath.FromSlash("/srv/music/lists")
+	tests := []struct {
+		loc  string
+		want string
+	}{
+		{loc: "a.mp3", want: "/srv/music/lists/a.mp3"},
+		{loc: "../albums/b.mp3", want: "/srv/music/albums/b.mp3"},
+		{loc: `..\albums\b.mp3`, want: "/srv/music/albums/b.mp3"},
+		{loc: "/srv/other/c.mp3", want: "/srv/other/c.mp3"},
+		{loc: "file:///srv/other/c%20d.mp3", want: "/srv/other/c d.mp3"},
+		{loc: "./x/../d.mp3", want: "/srv/music/lists/d.mp3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.loc, func(t *testing.T) {
+			if got, want := resolve(dir, tt.loc), filepath.FromSlash(tt.want); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestAddPlaylists(t *testing.T) {
+	dir := filepath.FromSlash("/srv/music")
+	files := MediaItems{
+		{ID: "a", Title: "A", Class: MediaClassMusicTrack, path: filepath.Join(dir, "a.mp3")},
+		{ID: "b", Title: "B", Class: MediaClassMusicTrack, path: filepath.Join(dir, "sub", "b.mp3")},
+	}
+	good := MediaItem{ID: "good", ParentID: "folder", Title: "Good", Class: MediaClassPlaylistContainer}
+	bad := MediaItem{ID: "bad", ParentID: "folder", Title: "Bad", Class: MediaClassPlaylistContainer}
+	children := map[string]MediaItems{"folder": {good, bad, files[0]}}
+	addPlaylists(children, []playlist{
+		{item: good, dir: dir, entries: []playlistEntry{
+			{Location: "sub/b.mp3"},
+			{Location: "missing.mp3"},
+			{Location: "a.mp3"},
+			// The same file twice has different IDs.
+			{Location: "a.mp3"},
+			{Location: "http://example.com/radio.mp3", Title: "Radio"},
+		}},
+		{item: bad, dir: dir, entries: []playlistEntry{{Location: "missing.mp3"}}},
+	}, files)
+
+	// The playlist whose entries are all unknown is left out.
+	if got := children["folder"]; len(got) != 2 || got[0].ID != "good" || got[1].ID != "a" {
+		t.Errorf("got %+v", got)
+	}
+	got := children["good"]
+	if len(got) != 4 {
+		t.Fatalf("got %+v", got)
+	}
+	for n, want := range []string{"b", "a", "a"} {
+		if i := got[n]; i.RefID != want || i.ParentID != "good" {
+			t.Errorf("got %s of %s in %s, want %s", i.ID, i.RefID, i.ParentID, want)
+		}
+	}
+	if got[1].ID == got[2].ID {
+		t.Error("the same file has the same ID")
+	}
+	if radio := got[3]; radio.Title != "Radio" || radio.Class != MediaClassAudioBroadcast || radio.URL.String() != "http://example.com/radio.mp3" ||
+		radio.ProtocolInfo != "http-get:*:audio/mpeg:*" {
+		t.Errorf("got %+v", radio)
+	}
+}
+
+func TestMediaLibrary_Playlists(t *testing.T) {
+	dir := t.TempDir()
+	b, err := os.ReadFile("testdata/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string][]byte{
+		"images/a.jpg":     b,
+		"lists/good.m3u":   []byte("../images/a.jpg\n"),
+		"lists/empty.m3u":  []byte("missing.jpg\n"),
+		"others/empty.pls": []byte("[playlist]\nFile1=missing.jpg\n"),
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := MediaLibrary{BaseURL: &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"}, Roots: []Root{{Path: dir}}}
+	if err := m.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &m.Roots[0]
+	// The folder of the empty playlist is pruned as it's empty without it.
+	if got := m.children[r.id(".")]; len(got) != 2 || got[0].Title != "images" || got[1].Title != "lists" {
+		t.Errorf("got %+v", got)
+	}
+	if got := m.children[r.id("lists")]; len(got) != 1 || got[0].Title != "good" || got[0].ChildCount != 1 {
+		t.Errorf("got %+v", got)
+	}
+	if got := m.children[r.id("lists/good.m3u")]; len(got) != 1 || got[0].RefID != r.id("images/a.jpg") {
+		t.Errorf("got %+v", got)
+	}
+}
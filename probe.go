@@ -0,0 +1,137 @@
+package cast
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// metadata is the information about a media file read from its content.
+type metadata struct {
+	Duration time.Duration
+	Width    int
+	Height   int
+	// Bitrate is the average bitrate in bytes per second.
+	Bitrate    int
+	Channels   int
+	SampleRate int
+	// Orientation is the EXIF orientation of images, 1 to 8.
+	Orientation int
+	// VideoCodec and AudioCodec are the codecs of the first video and audio tracks, e.g. h264 and aac.
+	VideoCodec string
+	AudioCodec string
+	// VideoProfile is the profile_idc of H.264 videos, e.g. 100 for High.
+	VideoProfile int
+	// TSPacketSize is the packet size of MPEG transport streams, 188, or 192 with a timestamp before each packet.
+	TSPacketSize int
+	// TSTimestamped tells if the timestamps before the packets are valid rather than zero.
+	TSTimestamped bool
+	// TimeSeekable tells if the times in the file can be mapped to offsets, e.g. by the sample tables of MP4.
+	TimeSeekable bool
+
+	// The following are read from the tags of audio files. Date is also read from the EXIF of images.
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Genre       string
+	Track       int
+	// Date is in the form of YYYY-MM-DD, optionally followed by THH:MM:SS.
+	Date string
+	// Picture is the cover art embedded in audio files.
+	Picture picture
+
+	// Playlist is the entries of playlist files.
+	Playlist []playlistEntry
+}
+
+// tagged tells if the metadata has any tags.
+func (md *metadata) tagged() bool {
+	return md.Title != "" || md.Artist != "" || md.AlbumArtist != "" || md.Album != "" || md.Genre != "" || md.Track != 0 || md.Date != ""
+}
+
+// probes are the metadata parsers for the MIME types.
+var probes = map[string]func(r io.ReaderAt, size int64, md *metadata) error{
+	"video/mp4":            parseMP4,
+	"video/x-m4v":          parseMP4,
+	"video/quicktime":      parseMP4,
+	"video/3gpp":           parseMP4,
+	"video/3gpp2":          parseMP4,
+	"audio/mp4":            parseMP4,
+	"audio/x-m4a":          parseMP4,
+	"video/x-matroska":     parseMatroska,
+	"video/webm":           parseMatroska,
+	"video/mp2t":           parseMPEGTS,
+	"audio/webm":           parseMatroska,
+	"audio/mpeg":           parseID3,
+	"audio/wav":            parseWAV,
+	"audio/flac":           parseFLAC,
+	"audio/ogg":            parseOgg,
+	"image/jpeg":           parseJPEG,
+	"image/tiff":           parseTIFF,
+	"image/png":            parseImage,
+	"image/gif":            parseImage,
+	"audio/x-mpegurl":      parseM3U,
+	"audio/x-scpls":        parsePLS,
+	"application/xspf+xml": parseXSPF,
+}
+
+var errProbePanic = errors.New("parser panicked")
+
+// probe reads the metadata of the media file at path into e.
+// If the parser panics on a malformed file, the file is kept without metadata so that it doesn't bring down the scan.
+func probe(path string, e *entry) {
+	parse, ok := probes[e.MIME]
+	if !ok {
+		return
+	}
+
+	if err := func() (err error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				e.Meta = metadata{}
+				err = fmt.Errorf("%w: %v", errProbePanic, r)
+			}
+		}()
+
+		err = parse(f, e.Size, &e.Meta)
+		if p := &e.Meta.Picture; p.Size > 0 {
+			// The size of the embedded picture tells whether it's served as is or resized.
+			if c, _, err := image.DecodeConfig(io.NewSectionReader(f, p.Offset, p.Size)); err == nil {
+				p.Width, p.Height = c.Width, c.Height
+			}
+		}
+		return err
+	}(); err != nil {
+		l := log.WithField("path", path).WithError(err)
+		if errors.Is(err, errProbePanic) {
+			l.Warn("Failed to probe.")
+		} else {
+			l.Debug("Failed to probe.")
+		}
+	}
+
+	if e.Meta.Bitrate == 0 && e.Meta.Duration > 0 {
+		e.Meta.Bitrate = int(float64(e.Size) / e.Meta.Duration.Seconds())
+	}
+}
+
+// Duration is a time.Duration formatted as in DIDL-Lite, i.e. H+:MM:SS.FFF.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	ms := time.Duration(d).Milliseconds()
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,137 @@
+package cast
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProbe_Panic(t *testing.T) {
+	const mime = "video/x-test"
+	probes[mime] = func(r io.ReaderAt, size int64, md *metadata) error {
+		md.Title = "partial"
+		var b []byte
+		_ = b[size]
+		return nil
+	}
+	defer delete(probes, mime)
+
+	path := filepath.Join(t.TempDir(), "a.test")
+	if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := entry{MIME: mime, Size: 4}
+	probe(path, &e)
+	if e.MIME != mime || e.Meta.Title != "" {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestProbe_Error(t *testing.T) {
+	const mime = "video/x-test"
+	probes[mime] = func(r io.ReaderAt, size int64, md *metadata) error {
+		md.Duration = 2 * time.Second
+		return errors.New("truncated")
+	}
+	defer delete(probes, mime)
+
+	path := filepath.Join(t.TempDir(), "a.test")
+	if err := os.WriteFile(path, make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := entry{MIME: mime, Size: 1000}
+	probe(path, &e)
+	// What's read before the error is kept.
+	if e.Meta.Duration != 2*time.Second || e.Meta.Bitrate != 500 {
+		t.Errorf("got %+v", e.Meta)
+	}
+}
+
+func TestDuration_String(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 0, want: "0:00:00.000"},
+		{d: 1500 * time.Millisecond, want: "0:00:01.500"},
+		{d: 61 * time.Minute, want: "1:01:00.000"},
+		{d: 100*time.Hour + 59*time.Second, want: "100:00:59.000"},
+	}
+	for _, tt := range tests {
+		if got := Duration(tt.d).String(); got != tt.want {
+			t.Errorf("Duration(%v) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestProbe_Picture(t *testing.T) {
+	const mime = "audio/x-test"
+	pic, err := os.ReadFile("testdata/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	probes[mime] = func(r io.ReaderAt, size int64, md *metadata) error {
+		md.Picture = picture{Offset: 4, Size: int64(len(pic)), MIME: "image/jpeg"}
+		return nil
+	}
+	defer delete(probes, mime)
+
+	path := filepath.Join(t.TempDir(), "a.test")
+	b := append(append([]byte("TEST"), pic...), "tail"...)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := entry{MIME: mime, Size: int64(len(b))}
+	probe(path, &e)
+	// The size of the embedded picture is read for the cover art.
+	if e.Meta.Picture.Width != 32 || e.Meta.Picture.Height != 16 {
+		t.Errorf("got %+v", e.Meta.Picture)
+	}
+}
+
+func TestProbes_Truncated(t *testing.T) {
+	tests := []struct {
+		path  string
+		parse func(r io.ReaderAt, size int64, md *metadata) error
+	}{
+		{path: "testdata/exif.jpg", parse: parseJPEG},
+		{path: "testdata/h264.mp4", parse: parseMP4},
+		{path: "testdata/tags.m4a", parse: parseMP4},
+		{path: "testdata/h264.ts", parse: parseMPEGTS},
+		{path: "testdata/hevc.mkv", parse: parseMatroska},
+		{path: "testdata/vp9.webm", parse: parseMatroska},
+		{path: "testdata/tags.mp3", parse: parseID3},
+		{path: "testdata/tags.flac", parse: parseFLAC},
+		{path: "testdata/tags.ogg", parse: parseOgg},
+		{path: "testdata/tags.opus", parse: parseOgg},
+		{path: "testdata/pcm.wav", parse: parseWAV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			b, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Every truncation of a valid file must fail or succeed without panicking.
+			for n := 0; n < len(b); n++ {
+				truncated(t, tt.parse, b[:n])
+			}
+		})
+	}
+}
+
+// truncated parses b and reports a panic with the length of b.
+func truncated(t *testing.T, parse func(r io.ReaderAt, size int64, md *metadata) error, b []byte) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("panicked at %d bytes: %v", len(b), r)
+		}
+	}()
+	var md metadata
+	_ = parse(bytes.NewReader(b), int64(len(b)), &md)
+}
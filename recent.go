@@ -0,0 +1,61 @@
+package cast
+
+import (
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// recentID is the object ID of the virtual container which contains the most recently added items.
+var recentID = virtualID("recent")
+
+// addRecent adds the virtual container of the m.Recent most recently added items, newest first, to children.
+// Items are dated by the later of their modification time and when they were found for the first time.
+// Nothing is added if m.Recent is zero.
+// If m.RecentAge is set, the content tree is rebuilt again when the oldest of the items gets older than it.
+// It must be called with m.mu locked.
+func (m *MediaLibrary) addRecent(children map[string]MediaItems, items MediaItems) {
+	if m.recentTimer != nil {
+		m.recentTimer.Stop()
+		m.recentTimer = nil
+	}
+	if m.Recent <= 0 {
+		return
+	}
+
+	items = append(MediaItems(nil), items...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].added.After(items[j].added)
+	})
+	if len(items) > m.Recent {
+		items = items[:m.Recent]
+	}
+	if m.RecentAge > 0 {
+		since := time.Now().Add(-m.RecentAge)
+		for n, i := range items {
+			if i.added.Before(since) {
+				items = items[:n]
+				break
+			}
+		}
+	}
+
+	children[rootID] = append(children[rootID], container(recentID, rootID, "Recently Added", MediaClassContainer))
+	addRefs(children, recentID, items)
+
+	if m.RecentAge > 0 && len(items) > 0 {
+		m.recentTimer = time.AfterFunc(time.Until(items[len(items)-1].added.Add(m.RecentAge)), m.expireRecent)
+	}
+}
+
+// expireRecent rebuilds the content tree so that the items which have got too old leave the "Recently Added" container.
+func (m *MediaLibrary) expireRecent() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.systemUpdateID++
+	m.rebuild()
+
+	log.WithField("systemUpdateID", m.systemUpdateID).Info("Expired recently added items.")
+}
@@ -0,0 +1,115 @@
+package cast
+
+import (
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// recentLibrary returns the library of files added at the times.
+func recentLibrary(recent int, age time.Duration, added ...time.Time) *MediaLibrary {
+	dir := filepath.FromSlash("/srv/music")
+	m := MediaLibrary{
+		BaseURL:   &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"},
+		Roots:     []Root{{Label: "music", Path: dir}},
+		Recent:    recent,
+		RecentAge: age,
+		entries:   map[string]*entry{dir: {Dir: true}},
+	}
+	for n, t := range added {
+		m.entries[filepath.Join(dir, strconv.Itoa(n)+".mp3")] = &entry{MIME: "audio/mpeg", ModTime: t.Add(-time.Hour), Added: t}
+	}
+	return &m
+}
+
+// recentTitles returns the titles of the items in the "Recently Added" container.
+func recentTitles(m *MediaLibrary) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var titles []string
+	for _, i := range m.children[recentID] {
+		titles = append(titles, i.Title)
+	}
+	return titles
+}
+
+func TestMediaLibrary_AddRecent(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		recent int
+		age    time.Duration
+		want   []string
+	}{
+		{name: "disabled", recent: 0, want: nil},
+		{name: "newest first", recent: 10, want: []string{"2.mp3", "0.mp3", "1.mp3"}},
+		{name: "limited by number", recent: 2, want: []string{"2.mp3", "0.mp3"}},
+		{name: "limited by age", recent: 10, age: 36 * time.Hour, want: []string{"2.mp3", "0.mp3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := recentLibrary(tt.recent, tt.age, now.Add(-24*time.Hour), now.Add(-48*time.Hour), now.Add(-time.Hour))
+			m.mu.Lock()
+			m.rebuild()
+			m.mu.Unlock()
+			defer func() {
+				if m.recentTimer != nil {
+					m.recentTimer.Stop()
+				}
+			}()
+
+			got := recentTitles(m)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got, tt.want)
+					break
+				}
+			}
+			if _, ok := m.children[recentID]; ok != (tt.recent > 0) {
+				t.Errorf("got container %t", ok)
+			}
+		})
+	}
+}
+
+func TestMediaLibrary_ExpireRecent(t *testing.T) {
+	const age = time.Hour
+	now := time.Now()
+	// The second file gets older than the age soon after the rebuild.
+	m := recentLibrary(10, age, now, now.Add(-age+300*time.Millisecond))
+	m.mu.Lock()
+	m.rebuild()
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.recentTimer.Stop()
+	}()
+	if got := recentTitles(m); len(got) != 2 {
+		t.Fatalf("got %q", got)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if got := recentTitles(m); len(got) == 1 {
+			if got[0] != "0.mp3" {
+				t.Errorf("got %q", got)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("not expired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.systemUpdateID != 1 || m.containerUpdateIDs[recentID] != 1 {
+		t.Errorf("got system update ID %d and container update ID %d", m.systemUpdateID, m.containerUpdateIDs[recentID])
+	}
+}
@@ -0,0 +1,168 @@
+package cast
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// scanProgressInterval is how often the progress of a scan is logged.
+const scanProgressInterval = 5 * time.Second
+
+// scan walks the file or the directory tree at dir under the root r and examines the files in it with m.Workers concurrent workers.
+// Files found in known with the same size and modification time are not examined again.
+// Ignored files and directories are skipped.
+// Symlinked directories outside of dir found in known count as already followed.
+// If visit is not nil, it's called for every directory before its children are read.
+// The result doesn't depend on the order in which the workers finish.
+func (m *MediaLibrary) scan(r *Root, dir string, known map[string]*entry, visit func(path string)) (map[string]*entry, error) {
+	workers := m.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	seen := map[fileID]string{}
+	for p, e := range known {
+		if e.link != nil && p != dir && !strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			seen[*e.link] = p
+		}
+	}
+
+	type result struct {
+		path  string
+		entry *entry
+	}
+
+	var (
+		start   = time.Now()
+		found   int64
+		paths   = make(chan string)
+		results = make(chan result)
+		wg      sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range paths {
+				e, err := newFileEntry(p, known)
+				if err != nil {
+					log.WithField("path", p).WithError(err).Warn("Failed to stat")
+					continue
+				}
+				results <- result{path: p, entry: e}
+			}
+		}()
+	}
+
+	var (
+		files    = map[string]*entry{}
+		examined int
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(scanProgressInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case res, ok := <-results:
+				if !ok {
+					return
+				}
+				files[res.path] = res.entry
+				if res.entry != known[res.path] {
+					examined++
+				}
+			case <-t.C:
+				log.WithFields(log.Fields{
+					"dir":      dir,
+					"found":    atomic.LoadInt64(&found),
+					"scanned":  len(files),
+					"examined": examined,
+				}).Info("Scanning.")
+			}
+		}
+	}()
+
+	var (
+		entries = map[string]*entry{}
+		rules   = map[string]ignoreRules{}
+	)
+	err := m.walk(dir, seen, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.WithField("path", p).WithError(err).Warn("Failed to walk")
+			return nil
+		}
+
+		rel, ok := r.rel(p)
+		if !ok {
+			return nil
+		}
+		parent := path.Dir(rel)
+		rs, ok := rules[parent]
+		if !ok {
+			rs = m.ignoreRules(r, parent)
+		}
+		if m.ignored(rs, rel, d.IsDir()) {
+			log.WithField("path", p).Debug("Ignored.")
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if rel == "." {
+				rules[rel] = m.ignoreRules(r, rel)
+			} else {
+				rules[rel] = rs.with(p, rel)
+			}
+			if visit != nil {
+				visit(p)
+			}
+			e := entry{Dir: true}
+			if l, ok := d.(*linkDirEntry); ok {
+				e.link = &l.target
+			}
+			entries[p] = &e
+			return nil
+		}
+
+		atomic.AddInt64(&found, 1)
+		paths <- p
+		return nil
+	})
+
+	close(paths)
+	wg.Wait()
+	close(results)
+	<-done
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p, e := range files {
+		entries[p] = e
+	}
+
+	log.WithFields(log.Fields{
+		"dir":      dir,
+		"scanned":  len(files),
+		"examined": examined,
+		"elapsed":  time.Since(start),
+	}).Info("Scanned.")
+
+	return entries, nil
+}
@@ -0,0 +1,187 @@
+package cast
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMediaLibrary_Scan(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"a/1.txt", "a/2.txt", "b/c/3.txt", "4.txt", ".hidden/5.txt"} {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("text"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A parser which panics must fail only the file.
+	const mime = "text/plain; charset=utf-8"
+	probes[mime] = func(r io.ReaderAt, size int64, md *metadata) error {
+		panic("bug")
+	}
+	defer delete(probes, mime)
+
+	m := MediaLibrary{BaseURL: &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"}, Roots: []Root{{Path: dir}}, Workers: 3, AllFiles: true}
+	if err := m.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for p, e := range m.entries {
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !e.Dir && e.MIME != mime {
+			t.Errorf("%s: %s", rel, e.MIME)
+		}
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	want := []string{".", "4.txt", "a", "a/1.txt", "a/2.txt", "b", "b/c", "b/c/3.txt"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestNewMediaLibrary(t *testing.T) {
+	dir := t.TempDir()
+	b, err := os.ReadFile("testdata/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a", "1.jpg"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMediaLibrary(&url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The root, its subdirectory and the image come first in the order of the tree, followed by the virtual containers.
+	items := m.Items()
+	if len(items) < 3 {
+		t.Fatalf("got %d items", len(items))
+	}
+	for i, want := range []struct {
+		title    string
+		parentID string
+	}{
+		{title: filepath.Base(dir), parentID: rootID},
+		{title: "a", parentID: items[0].ID},
+		{title: "1.jpg", parentID: items[1].ID},
+	} {
+		if items[i].Title != want.title || items[i].ParentID != want.parentID {
+			t.Errorf("got %s in %s, want %s in %s", items[i].Title, items[i].ParentID, want.title, want.parentID)
+		}
+	}
+	for _, i := range items {
+		if m.objects[i.ID] == nil {
+			t.Errorf("%s isn't in the tree", i.ID)
+		}
+	}
+}
+
+func TestMediaLibrary_Scan_StableIDs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(paths ...string) {
+		t.Helper()
+		for _, p := range paths {
+			p = filepath.Join(dir, filepath.FromSlash(p))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte("text"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// ids returns the object IDs by the titles of the objects and their containers joined by slashes.
+	ids := func(m *MediaLibrary) map[string]string {
+		ids := map[string]string{"": rootID}
+		var walk func(id, path string)
+		walk = func(id, path string) {
+			for _, c := range m.children[id] {
+				p := path + "/" + c.Title
+				if _, ok := ids[p]; ok {
+					t.Fatalf("duplicate %s", p)
+				}
+				ids[p] = c.ID
+				walk(c.ID, p)
+			}
+		}
+		walk(rootID, "")
+		return ids
+	}
+	scan := func(m *MediaLibrary) map[string]string {
+		t.Helper()
+		if err := m.Scan(); err != nil {
+			t.Fatal(err)
+		}
+		return ids(m)
+	}
+	same := func(got, want map[string]string) {
+		t.Helper()
+		for p, id := range want {
+			if got[p] != id {
+				t.Errorf("%s: got %q, want %q", p, got[p], id)
+			}
+		}
+	}
+	index := filepath.Join(t.TempDir(), "index")
+	library := func() *MediaLibrary {
+		return &MediaLibrary{BaseURL: &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"}, Roots: []Root{{Path: dir, Label: "files"}}, IndexPath: index, AllFiles: true}
+	}
+
+	write("a/1.txt", "a/2.txt", "b/c/3.txt", "4.txt")
+	m := library()
+	want := scan(m)
+	if len(want) != 9 {
+		t.Fatalf("got %v", want)
+	}
+	// IDs are safe in both DIDL-Lite and SOAP.
+	for p, id := range want {
+		if id == rootID {
+			continue
+		}
+		if len(id) != 16 || strings.Trim(id, "0123456789abcdef") != "" {
+			t.Errorf("%s: got %q", p, id)
+		}
+	}
+
+	t.Run("rescan", func(t *testing.T) {
+		same(scan(m), want)
+	})
+	t.Run("restart", func(t *testing.T) {
+		if _, err := os.Stat(index); err != nil {
+			t.Fatal(err)
+		}
+		same(scan(library()), want)
+	})
+	t.Run("siblings added", func(t *testing.T) {
+		// Files which come first in the tree don't change the IDs of the others.
+		write("0.txt", "a/0.txt", "0/5.txt")
+		got := scan(library())
+		same(got, want)
+		if len(got) != len(want)+4 {
+			t.Errorf("got %v", got)
+		}
+	})
+}
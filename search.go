@@ -0,0 +1,326 @@
+package cast
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// searchProperties are the properties which can be used in search criteria.
+var searchProperties = []string{
+	"@id",
+	"@parentID",
+	"@refID",
+	"dc:title",
+	"upnp:class",
+	"upnp:artist",
+	"upnp:album",
+	"upnp:genre",
+	"upnp:originalTrackNumber",
+	"dc:date",
+}
+
+// property returns the value of the property of the object i, or false if it doesn't have one.
+// Like in DIDL-Lite, properties which aren't allowed for the class of the object are missing.
+func property(i MediaItem, name string) (string, bool) {
+	var v string
+	switch name {
+	case "@id":
+		v = i.ID
+	case "@parentID":
+		v = i.ParentID
+	case "@refID":
+		v = i.RefID
+	case "dc:title":
+		v = i.Title
+	case "upnp:class":
+		v = i.Class.String()
+	default:
+		if !i.Class.Allows(name) {
+			return "", false
+		}
+		switch name {
+		case "upnp:artist":
+			v = i.Artist
+		case "upnp:album":
+			v = i.Album
+		case "upnp:genre":
+			v = i.Genre
+		case "upnp:originalTrackNumber":
+			if i.OriginalTrackNumber > 0 {
+				v = strconv.Itoa(i.OriginalTrackNumber)
+			}
+		case "dc:date":
+			v = i.Date
+		}
+	}
+	return v, v != ""
+}
+
+// criteria tells if an object matches search criteria.
+type criteria func(MediaItem) bool
+
+var errInvalidCriteria = errors.New("invalid search criteria")
+
+// parseCriteria parses search criteria of the ContentDirectory service, e.g.
+// `upnp:class derivedfrom "object.item.audioItem" and (dc:title contains "love" or upnp:artist = "Queen")`.
+func parseCriteria(s string) (criteria, error) {
+	if strings.TrimSpace(s) == "*" {
+		return func(MediaItem) bool { return true }, nil
+	}
+	tokens, err := tokenizeCriteria(s)
+	if err != nil {
+		return nil, err
+	}
+	p := criteriaParser{tokens: tokens}
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.tokens) > 0 {
+		return nil, fmt.Errorf("%w: unexpected %s", errInvalidCriteria, p.tokens[0])
+	}
+	return c, nil
+}
+
+// tokenizeCriteria splits search criteria into parentheses, quoted strings, operators and words.
+// Quoted strings are kept quoted so that they can be told from words.
+func tokenizeCriteria(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case c == '"':
+			var b strings.Builder
+			b.WriteByte('"')
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("%w: unterminated string", errInvalidCriteria)
+			}
+			tokens = append(tokens, b.String())
+			i = j + 1
+		case strings.IndexByte("=!<>", c) >= 0:
+			j := i + 1
+			if j < len(s) && s[j] == '=' {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t\r\n()\"=!<>", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// criteriaParser is a recursive descent parser of search criteria where and binds tighter than or.
+type criteriaParser struct {
+	tokens []string
+}
+
+func (p *criteriaParser) next() (string, bool) {
+	if len(p.tokens) == 0 {
+		return "", false
+	}
+	t := p.tokens[0]
+	p.tokens = p.tokens[1:]
+	return t, true
+}
+
+func (p *criteriaParser) peek(s string) bool {
+	return len(p.tokens) > 0 && strings.EqualFold(p.tokens[0], s)
+}
+
+func (p *criteriaParser) or() (criteria, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("or") {
+		p.tokens = p.tokens[1:]
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		prev := l
+		l = func(i MediaItem) bool { return prev(i) || r(i) }
+	}
+	return l, nil
+}
+
+func (p *criteriaParser) and() (criteria, error) {
+	l, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("and") {
+		p.tokens = p.tokens[1:]
+		r, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		prev := l
+		l = func(i MediaItem) bool { return prev(i) && r(i) }
+	}
+	return l, nil
+}
+
+func (p *criteriaParser) expression() (criteria, error) {
+	if p.peek("(") {
+		p.tokens = p.tokens[1:]
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")") {
+			return nil, fmt.Errorf("%w: missing )", errInvalidCriteria)
+		}
+		p.tokens = p.tokens[1:]
+		return c, nil
+	}
+
+	name, ok1 := p.next()
+	op, ok2 := p.next()
+	value, ok3 := p.next()
+	if !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf("%w: incomplete expression", errInvalidCriteria)
+	}
+	if strings.EqualFold(op, "exists") {
+		var want bool
+		switch strings.ToLower(value) {
+		case "true":
+			want = true
+		case "false":
+		default:
+			return nil, fmt.Errorf("%w: %s", errInvalidCriteria, value)
+		}
+		return func(i MediaItem) bool {
+			_, ok := property(i, name)
+			return ok == want
+		}, nil
+	}
+	if !strings.HasPrefix(value, `"`) {
+		return nil, fmt.Errorf("%w: %s is not quoted", errInvalidCriteria, value)
+	}
+	value = value[1:]
+
+	match, err := relation(op, value)
+	if err != nil {
+		return nil, err
+	}
+	return func(i MediaItem) bool {
+		v, ok := property(i, name)
+		if !ok {
+			// Objects without the property never match but those which don't contain the value.
+			return strings.EqualFold(op, "doesNotContain")
+		}
+		return match(v)
+	}, nil
+}
+
+// relation returns the test of a property value by the relational operator op with value.
+// Strings are compared case-insensitively and numbers numerically.
+func relation(op, value string) (func(string) bool, error) {
+	compare := func(v string) int {
+		if a, err := strconv.Atoi(v); err == nil {
+			if b, err := strconv.Atoi(value); err == nil {
+				return a - b
+			}
+		}
+		return strings.Compare(strings.ToLower(v), strings.ToLower(value))
+	}
+	switch strings.ToLower(op) {
+	case "=":
+		return func(v string) bool { return compare(v) == 0 }, nil
+	case "!=":
+		return func(v string) bool { return compare(v) != 0 }, nil
+	case "<":
+		return func(v string) bool { return compare(v) < 0 }, nil
+	case "<=":
+		return func(v string) bool { return compare(v) <= 0 }, nil
+	case ">":
+		return func(v string) bool { return compare(v) > 0 }, nil
+	case ">=":
+		return func(v string) bool { return compare(v) >= 0 }, nil
+	case "contains":
+		return func(v string) bool { return strings.Contains(strings.ToLower(v), strings.ToLower(value)) }, nil
+	case "doesnotcontain":
+		return func(v string) bool { return !strings.Contains(strings.ToLower(v), strings.ToLower(value)) }, nil
+	case "derivedfrom":
+		return func(v string) bool {
+			v, value := strings.ToLower(v), strings.ToLower(value)
+			return v == value || strings.HasPrefix(v, value+".")
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %s", errInvalidCriteria, op)
+	}
+}
+
+func (m *MediaLibrary) search(p *action) (*actionResponse, error) {
+	var containerID, crit string
+	for _, arg := range p.Arguments {
+		switch arg.XMLName.Local {
+		case "ContainerID":
+			containerID = arg.Value
+		case "SearchCriteria":
+			// Arguments are raw XML, in which quotes are often escaped.
+			crit = html.UnescapeString(arg.Value)
+		}
+	}
+
+	match, err := parseCriteria(crit)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var (
+		res  MediaItems
+		seen = map[string]struct{}{}
+	)
+	// The same file can be found in the library roots and in the virtual containers, the former first.
+	var walk func(id string)
+	walk = func(id string) {
+		for _, i := range m.children[id] {
+			key := i.ID
+			if i.RefID != "" {
+				key = i.RefID
+			}
+			if _, ok := seen[key]; !ok && match(i) {
+				seen[key] = struct{}{}
+				res = append(res, i)
+			}
+			if i.Class.Container() {
+				walk(i.ID)
+			}
+		}
+	}
+	walk(containerID)
+
+	return p.response([]argument{
+		{XMLName: xml.Name{Local: "Result"}, Value: res.String()},
+		{XMLName: xml.Name{Local: "NumberReturned"}, Value: strconv.Itoa(len(res))},
+		{XMLName: xml.Name{Local: "TotalMatches"}, Value: strconv.Itoa(len(res))},
+		{XMLName: xml.Name{Local: "UpdateID"}, Value: strconv.Itoa(m.containerUpdateIDs[containerID])},
+	}...), nil
+}
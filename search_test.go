@@ -0,0 +1,173 @@
+package cast
+
+import (
+	"encoding/xml"
+	"errors"
+	"html"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeCriteria(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+		err  error
+	}{
+		{s: `dc:title = "a"`, want: []string{"dc:title", "=", `"a`}},
+		{s: `(upnp:class derivedfrom"object.item") and @id!="1"`, want: []string{"(", "upnp:class", "derivedfrom", `"object.item`, ")", "and", "@id", "!=", `"1`}},
+		{s: "a<=\"1\" b>=\"2\"\tc<\"3\"\nd>\"4\"", want: []string{"a", "<=", `"1`, "b", ">=", `"2`, "c", "<", `"3`, "d", ">", `"4`}},
+		{s: `dc:title contains "say \"hi\" \\ bye"`, want: []string{"dc:title", "contains", `"say "hi" \ bye`}},
+		{s: `dc:title = ""`, want: []string{"dc:title", "=", `"`}},
+		{s: `dc:title = "a`, err: errInvalidCriteria},
+		{s: "", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := tokenizeCriteria(tt.s)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCriteria(t *testing.T) {
+	track := MediaItem{
+		ID:                  "10",
+		ParentID:            "1",
+		Title:               "Love of My Life",
+		Class:               MediaClassMusicTrack,
+		Artist:              "Queen",
+		Album:               "A Night at the Opera",
+		Genre:               "Rock",
+		OriginalTrackNumber: 9,
+		Date:                "1975-11-21",
+	}
+	video := MediaItem{ID: "20", ParentID: "2", Title: "Holiday", Class: MediaClassVideoItem, Genre: "Home Video"}
+	folder := MediaItem{ID: "1", ParentID: "0", Title: "Music", Class: MediaClassStorageFolder}
+
+	tests := []struct {
+		criteria string
+		want     []string
+		err      error
+	}{
+		{criteria: "*", want: []string{"10", "20", "1"}},
+		{criteria: " * ", want: []string{"10", "20", "1"}},
+		{criteria: `upnp:class derivedfrom "object.item"`, want: []string{"10", "20"}},
+		{criteria: `upnp:class derivedfrom "object.item.audioItem"`, want: []string{"10"}},
+		{criteria: `upnp:class derivedfrom "object.item.audio"`, want: nil},
+		{criteria: `upnp:class = "object.container.storageFolder"`, want: []string{"1"}},
+		{criteria: `dc:title contains "LOVE"`, want: []string{"10"}},
+		{criteria: `dc:title doesNotContain "love"`, want: []string{"20", "1"}},
+		{criteria: `upnp:artist = "queen"`, want: []string{"10"}},
+		{criteria: `upnp:artist != "Queen"`, want: nil},
+		// Objects without the property don't contain any value.
+		{criteria: `upnp:artist doesNotContain "Queen"`, want: []string{"20", "1"}},
+		{criteria: `upnp:artist exists true`, want: []string{"10"}},
+		{criteria: `upnp:artist exists FALSE`, want: []string{"20", "1"}},
+		// Folders can't have a genre, which videos can.
+		{criteria: `upnp:genre exists true`, want: []string{"10", "20"}},
+		// Numbers are compared numerically and the other strings lexically.
+		{criteria: `upnp:originalTrackNumber < "10"`, want: []string{"10"}},
+		{criteria: `upnp:originalTrackNumber >= "10"`, want: nil},
+		{criteria: `dc:date >= "1975-01-01" and dc:date <= "1975-12-31"`, want: []string{"10"}},
+		{criteria: `@parentID = "0" or @id = "20"`, want: []string{"20", "1"}},
+		{criteria: `@refID exists true`, want: nil},
+		// And binds tighter than or.
+		{criteria: `@id = "1" or @id = "10" and upnp:genre = "Jazz"`, want: []string{"1"}},
+		{criteria: `(@id = "1" or @id = "10") and upnp:class derivedfrom "object.item"`, want: []string{"10"}},
+		{criteria: `upnp:class derivedfrom "object.item" AND (dc:title contains "day" OR upnp:artist = "Queen")`, want: []string{"10", "20"}},
+		{criteria: "", err: errInvalidCriteria},
+		{criteria: `dc:title =`, err: errInvalidCriteria},
+		{criteria: `dc:title = Love`, err: errInvalidCriteria},
+		{criteria: `dc:title like "Love"`, err: errInvalidCriteria},
+		{criteria: `dc:title exists maybe`, err: errInvalidCriteria},
+		{criteria: `(dc:title = "Love"`, err: errInvalidCriteria},
+		{criteria: `dc:title = "Love")`, err: errInvalidCriteria},
+		{criteria: `dc:title = "Love" and`, err: errInvalidCriteria},
+		{criteria: `dc:title = "Love" @id = "1"`, err: errInvalidCriteria},
+	}
+	for _, tt := range tests {
+		t.Run(tt.criteria, func(t *testing.T) {
+			match, err := parseCriteria(tt.criteria)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			for _, i := range []MediaItem{track, video, folder} {
+				if match(i) {
+					got = append(got, i.ID)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaLibrary_Search(t *testing.T) {
+	track := MediaItem{ID: "10", ParentID: "1", Title: "Track", Class: MediaClassMusicTrack}
+	m := MediaLibrary{
+		children: map[string]MediaItems{
+			"0": {
+				{ID: "1", ParentID: "0", Title: "Music", Class: MediaClassStorageFolder},
+				{ID: "2", ParentID: "0", Title: "Albums", Class: MediaClassContainer},
+			},
+			"1": {track},
+			// The same track in a virtual container is a reference to the original one.
+			"2": {{ID: "2$10", ParentID: "2", RefID: "10", Title: "Track", Class: MediaClassMusicTrack}},
+		},
+		containerUpdateIDs: map[string]int{"0": 3},
+	}
+	search := func(id, criteria string) (map[string]string, error) {
+		res, err := m.search(&action{
+			XMLName: xml.Name{Local: "Search"},
+			Arguments: []argument{
+				{XMLName: xml.Name{Local: "ContainerID"}, Value: id},
+				// Quotes are escaped in the raw XML.
+				{XMLName: xml.Name{Local: "SearchCriteria"}, Value: strings.ReplaceAll(criteria, `"`, "&quot;")},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		args := map[string]string{}
+		for _, a := range res.Arguments {
+			args[a.XMLName.Local] = html.UnescapeString(a.Value)
+		}
+		return args, nil
+	}
+
+	args, err := search("0", `upnp:class derivedfrom "object.item.audioItem"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args["NumberReturned"] != "1" || args["TotalMatches"] != "1" || args["UpdateID"] != "3" {
+		t.Errorf("got %v", args)
+	}
+	if !strings.Contains(args["Result"], `id="10"`) || strings.Contains(args["Result"], `id="2$10"`) {
+		t.Errorf("got %s", args["Result"])
+	}
+
+	// Only the descendants of the container are searched.
+	args, err = search("2", `dc:title = "Track"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args["NumberReturned"] != "1" || !strings.Contains(args["Result"], `id="2$10"`) {
+		t.Errorf("got %v", args)
+	}
+
+	if _, err := search("0", `dc:title = Track`); !errors.Is(err, errInvalidCriteria) {
+		t.Errorf("got %v, want %v", err, errInvalidCriteria)
+	}
+}
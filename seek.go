@@ -0,0 +1,130 @@
+package cast
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// timeIndex maps times in a media file to offsets.
+type timeIndex interface {
+	// seek returns the offset of the sync point at or before the time and the time of the sync point.
+	seek(d time.Duration) (int64, time.Duration)
+}
+
+// timeIndexes are the constructors of the time indexes of media files by their MIME types.
+// The parsers of these types tell if the index can be built in metadata.TimeSeekable.
+var timeIndexes = map[string]func(r io.ReaderAt, size int64) (timeIndex, error){
+	"video/mp4":       mp4TimeIndex,
+	"video/x-m4v":     mp4TimeIndex,
+	"video/quicktime": mp4TimeIndex,
+	"video/3gpp":      mp4TimeIndex,
+	"video/3gpp2":     mp4TimeIndex,
+	"audio/mp4":       mp4TimeIndex,
+	"audio/x-m4a":     mp4TimeIndex,
+	"video/mp2t":      mpegTSTimeIndex,
+}
+
+func mp4TimeIndex(r io.ReaderAt, size int64) (timeIndex, error) {
+	return newMP4Index(r, size)
+}
+
+func mpegTSTimeIndex(r io.ReaderAt, size int64) (timeIndex, error) {
+	return newMPEGTS(r, size)
+}
+
+var errInvalidNPT = errors.New("invalid npt range")
+
+// parseNPT parses the value of TimeSeekRange.dlna.org, e.g. npt=0:12:00.000- or npt=720-780.5.
+// end is 0 if it's omitted.
+func parseNPT(s string) (start, end time.Duration, err error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 4 || !strings.EqualFold(s[:4], "npt=") {
+		return 0, 0, errInvalidNPT
+	}
+	r := strings.SplitN(s[4:], "-", 2)
+	if len(r) != 2 {
+		return 0, 0, errInvalidNPT
+	}
+	if start, err = parseNPTTime(r[0]); err != nil {
+		return 0, 0, err
+	}
+	if r[1] == "" {
+		return start, 0, nil
+	}
+	if end, err = parseNPTTime(r[1]); err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, errInvalidNPT
+	}
+	return start, end, nil
+}
+
+// parseNPTTime parses a normal play time either in seconds or in H+:MM:SS, both optionally with a fraction.
+func parseNPTTime(s string) (time.Duration, error) {
+	var h, m int
+	if f := strings.Split(s, ":"); len(f) == 3 {
+		var err1, err2 error
+		h, err1 = strconv.Atoi(f[0])
+		m, err2 = strconv.Atoi(f[1])
+		if err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 {
+			return 0, errInvalidNPT
+		}
+		s = f[2]
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil || sec < 0 {
+		return 0, errInvalidNPT
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)), nil
+}
+
+// serveTimeSeek serves the part of the media file of the item i from the time in TimeSeekRange.dlna.org.
+// It starts from the sync point at or before the start time and ends before the sync point at or before the end time, if any.
+// Both of the ranges in time and in bytes are in TimeSeekRange.dlna.org of the response.
+func serveTimeSeek(w http.ResponseWriter, r *http.Request, i *MediaItem, f *os.File, size int64) {
+	d := time.Duration(i.Duration)
+	if !i.timeSeekable {
+		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return
+	}
+	start, end, err := parseNPT(r.Header.Get("TimeSeekRange.dlna.org"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if start >= d {
+		http.Error(w, http.StatusText(http.StatusRequestedRangeNotSatisfiable), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	idx, err := timeIndexes[i.mime](f, size)
+	if err != nil {
+		log.WithField("path", i.path).WithError(err).Warn("Failed to index.")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	first, from := idx.seek(start)
+	last, to := size-1, d
+	if end > 0 && end < d {
+		if o, t := idx.seek(end); o > first {
+			last, to = o-1, t
+		}
+	}
+
+	w.Header()["TimeSeekRange.dlna.org"] = []string{fmt.Sprintf("npt=%s-%s/%s bytes=%d-%d/%d", Duration(from), Duration(to), Duration(d), first, last, size)}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(last-first+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, io.NewSectionReader(f, first, last-first+1))
+	}
+}
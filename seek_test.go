@@ -0,0 +1,321 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseNPT(t *testing.T) {
+	tests := []struct {
+		s          string
+		start, end time.Duration
+		err        error
+	}{
+		{s: "npt=0-", start: 0},
+		{s: "npt=720-780.5", start: 720 * time.Second, end: 780*time.Second + 500*time.Millisecond},
+		{s: "npt=0:12:00.000-", start: 12 * time.Minute},
+		{s: "NPT=1:02:03.5-1:02:04", start: time.Hour + 2*time.Minute + 3500*time.Millisecond, end: time.Hour + 2*time.Minute + 4*time.Second},
+		{s: " npt=10- ", start: 10 * time.Second},
+		{s: "", err: errInvalidNPT},
+		{s: "npt=", err: errInvalidNPT},
+		{s: "npt=10", err: errInvalidNPT},
+		{s: "npt=-10", err: errInvalidNPT},
+		{s: "npt=now-", err: errInvalidNPT},
+		{s: "npt=10-5", err: errInvalidNPT},
+		{s: "npt=10-10", err: errInvalidNPT},
+		{s: "npt=0:60:00-", err: errInvalidNPT},
+		{s: "npt=-1:00:00-", err: errInvalidNPT},
+		{s: "bytes=0-", err: errInvalidNPT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			start, end, err := parseNPT(tt.s)
+			if err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if start != tt.start || end != tt.end {
+				t.Errorf("got %s-%s, want %s-%s", start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestMP4Index_Seek(t *testing.T) {
+	b, err := os.ReadFile("testdata/h264.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := newMP4Index(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The samples last 200 ms each, every 5th of them is a sync sample and each chunk has 5 of them.
+	tests := []struct {
+		d      time.Duration
+		offset int64
+		time   time.Duration
+	}{
+		{d: 0, offset: 942, time: 0},
+		{d: 999 * time.Millisecond, offset: 942, time: 0},
+		{d: time.Second, offset: 1452, time: time.Second},
+		{d: 1100 * time.Millisecond, offset: 1452, time: time.Second},
+		{d: 4900 * time.Millisecond, offset: 3632, time: 4 * time.Second},
+		{d: time.Hour, offset: 3632, time: 4 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.d.String(), func(t *testing.T) {
+			offset, d := idx.seek(tt.d)
+			if offset != tt.offset || d != tt.time {
+				t.Errorf("got %d at %s, want %d at %s", offset, d, tt.offset, tt.time)
+			}
+		})
+	}
+}
+
+func TestNewMP4Index_Malformed(t *testing.T) {
+	// table returns a full box of the type with the entries following the entry count.
+	table := func(typ string, entries ...uint32) []byte {
+		b := make([]byte, 8+4*len(entries))
+		binary.BigEndian.PutUint32(b[4:], uint32(len(entries)))
+		for n, e := range entries {
+			binary.BigEndian.PutUint32(b[8+4*n:], e)
+		}
+		return box(typ, b)
+	}
+	// file returns a file with a video track of 10 samples of 10 bytes in 2 chunks with the sample-to-chunk and the chunk offset tables.
+	file := func(stsc, stco []byte) []byte {
+		mdhd := make([]byte, 24)
+		binary.BigEndian.PutUint32(mdhd[12:], 1000)
+		stsz := box("stsz", make([]byte, 4), []byte{0, 0, 0, 10, 0, 0, 0, 10})
+		return box("moov", box("trak", box("mdia",
+			box("hdlr", []byte("\x00\x00\x00\x00\x00\x00\x00\x00vide")),
+			box("mdhd", mdhd),
+			box("minf", box("stbl", table("stts", 10, 100), stsc, stco, stsz)),
+		)), make([]byte, 100))
+	}
+
+	if _, err := newMP4Index(bytes.NewReader(file(table("stsc", 1, 5, 1), table("stco", 8, 58))), 1000); err != nil {
+		t.Fatalf("valid file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "no moov", data: box("free")},
+		{name: "fragmented", data: file(table("stsc"), table("stco"))},
+		{name: "first chunk 0", data: file(table("stsc", 0, 5, 1), table("stco", 8, 58))},
+		{name: "first chunk not 1", data: file(table("stsc", 2, 5, 1), table("stco", 8, 58))},
+		{name: "first chunks not increasing", data: file(table("stsc", 1, 5, 1, 1, 5, 1), table("stco", 8, 58))},
+		{name: "first chunk beyond chunks", data: file(table("stsc", 1, 5, 1, 3, 5, 1), table("stco", 8, 58))},
+		{name: "no samples per chunk", data: file(table("stsc", 1, 0, 1), table("stco", 8, 58))},
+		{name: "chunk beyond file", data: file(table("stsc", 1, 5, 1), table("stco", 8, 5000))},
+		{name: "no chunks", data: file(table("stsc", 1, 5, 1), table("stco"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newMP4Index(bytes.NewReader(tt.data), 1000); err != errMalformed {
+				t.Errorf("got %v, want %v", err, errMalformed)
+			}
+		})
+	}
+}
+
+// m2ts returns the M2TS file with the 188-byte packets of the MPEG-TS file b, each of which is prefixed with a timestamp.
+func m2ts(b []byte) []byte {
+	var out []byte
+	for ; len(b) >= tsPacketSize; b = b[tsPacketSize:] {
+		out = append(out, 0, 0, 0, 0)
+		out = append(out, b[:tsPacketSize]...)
+	}
+	return out
+}
+
+func TestMPEGTS_Seek(t *testing.T) {
+	ts, err := os.ReadFile("testdata/pcr.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A PCR comes every 100 ms followed by 2 packets without one, and the PCR base wraps around after 1 s.
+	tests := []struct {
+		name       string
+		data       []byte
+		packetSize int64
+	}{
+		{name: "MPEG-TS", data: ts, packetSize: 188},
+		{name: "M2TS", data: m2ts(ts), packetSize: 192},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, err := newMPEGTS(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if idx.packetSize != tt.packetSize {
+				t.Errorf("got packet size %d, want %d", idx.packetSize, tt.packetSize)
+			}
+			if d := time.Duration(idx.duration) * time.Second / tsClock; d != 5*time.Second {
+				t.Errorf("got duration %s, want 5s", d)
+			}
+
+			for _, s := range []struct {
+				d    time.Duration
+				pcr  int64
+				time time.Duration
+			}{
+				{d: 0, pcr: 0, time: 0},
+				{d: 950 * time.Millisecond, pcr: 9, time: 900 * time.Millisecond},
+				{d: time.Second, pcr: 10, time: time.Second},
+				{d: 2550 * time.Millisecond, pcr: 25, time: 2500 * time.Millisecond},
+				{d: time.Hour, pcr: 50, time: 5 * time.Second},
+			} {
+				offset, d := idx.seek(s.d)
+				if want := 3 * s.pcr * tt.packetSize; offset != want || d != s.time {
+					t.Errorf("seek(%s): got %d at %s, want %d at %s", s.d, offset, d, want, s.time)
+				}
+			}
+		})
+	}
+}
+
+func TestNewMPEGTS_Malformed(t *testing.T) {
+	ts, err := os.ReadFile("testdata/pcr.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "not synced", data: make([]byte, 3*tsPacketSize)},
+		{name: "no PCR", data: append(append([]byte{}, ts[tsPacketSize:3*tsPacketSize]...), ts[tsPacketSize:3*tsPacketSize]...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newMPEGTS(bytes.NewReader(tt.data), int64(len(tt.data))); err != errMalformed {
+				t.Errorf("got %v, want %v", err, errMalformed)
+			}
+		})
+	}
+}
+
+func TestParseTimeSeekable(t *testing.T) {
+	tests := []struct {
+		path  string
+		parse func(r io.ReaderAt, size int64, md *metadata) error
+		want  bool
+	}{
+		{path: "testdata/h264.mp4", parse: parseMP4, want: true},
+		{path: "testdata/pcr.ts", parse: parseMPEGTS, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			b, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var md metadata
+			if err := tt.parse(bytes.NewReader(b), int64(len(b)), &md); err != nil {
+				t.Fatal(err)
+			}
+			if md.TimeSeekable != tt.want {
+				t.Errorf("got %t, want %t", md.TimeSeekable, tt.want)
+			}
+		})
+	}
+
+	// The tags are still read from a file whose sample tables are broken, but it's not seekable by time.
+	b := box("moov", box("mvhd", make([]byte, 20)), box("trak", box("mdia", box("hdlr", []byte("\x00\x00\x00\x00\x00\x00\x00\x00vide")))))
+	var md metadata
+	_ = parseMP4(bytes.NewReader(b), int64(len(b)), &md)
+	if md.TimeSeekable {
+		t.Error("broken sample tables are seekable")
+	}
+}
+
+func TestServeTimeSeek(t *testing.T) {
+	f, err := os.Open("testdata/h264.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		seekable     bool
+		npt          string
+		status       int
+		contentRange string
+		timeSeek     string
+	}{
+		{name: "not indexed", seekable: false, npt: "npt=1-", status: http.StatusNotAcceptable},
+		{name: "invalid", seekable: true, npt: "npt=x-", status: http.StatusBadRequest},
+		{name: "beyond end", seekable: true, npt: "npt=5-", status: http.StatusRequestedRangeNotSatisfiable},
+		{
+			name:         "open",
+			seekable:     true,
+			npt:          "npt=1.1-",
+			status:       http.StatusPartialContent,
+			contentRange: "bytes 1452-4241/4242",
+			timeSeek:     "npt=0:00:01.000-0:00:05.000/0:00:05.000 bytes=1452-4241/4242",
+		},
+		{
+			name:         "closed",
+			seekable:     true,
+			npt:          "npt=1-3.5",
+			status:       http.StatusPartialContent,
+			contentRange: "bytes 1452-2796/4242",
+			timeSeek:     "npt=0:00:01.000-0:00:03.000/0:00:05.000 bytes=1452-2796/4242",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := MediaItem{
+				Duration:     Duration(5 * time.Second),
+				path:         f.Name(),
+				mime:         "video/mp4",
+				timeSeekable: tt.seekable,
+			}
+			r := httptest.NewRequest(http.MethodGet, "/media/1.mp4", nil)
+			r.Header.Set("TimeSeekRange.dlna.org", tt.npt)
+			w := httptest.NewRecorder()
+			serveTimeSeek(w, r, &i, f, fi.Size())
+
+			if w.Code != tt.status {
+				t.Fatalf("got %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusPartialContent {
+				return
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.contentRange {
+				t.Errorf("got Content-Range %q, want %q", got, tt.contentRange)
+			}
+			if got := w.Header()["TimeSeekRange.dlna.org"]; len(got) != 1 || got[0] != tt.timeSeek {
+				t.Errorf("got TimeSeekRange.dlna.org %q, want %q", got, tt.timeSeek)
+			}
+			var first, last, size int64
+			if _, err := fmt.Sscanf(tt.contentRange, "bytes %d-%d/%d", &first, &last, &size); err != nil {
+				t.Fatal(err)
+			}
+			if w.Body.Len() != int(last-first+1) {
+				t.Errorf("got %d bytes, want %d", w.Body.Len(), last-first+1)
+			}
+		})
+	}
+}
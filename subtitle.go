@@ -0,0 +1,157 @@
+package cast
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// subtitleTypes are the MIME types of sidecar subtitle files by their extensions.
+var subtitleTypes = map[string]string{
+	".srt": "text/srt",
+	".smi": "smi/caption",
+	".ass": "text/x-ass",
+	".ssa": "text/x-ssa",
+	".vtt": "text/vtt",
+}
+
+// Subtitle is a subtitle file next to a video, e.g. movie.srt or movie.ja.ass for movie.mp4.
+type Subtitle struct {
+	ID string
+	// Type is the format of the subtitle, i.e. the lower-cased extension without the dot.
+	Type string
+	// Language is the language in the file name, e.g. ja for movie.ja.ass, if any.
+	Language string
+	MIME     string
+	// URL serves the subtitle in its own format while SRTURL serves it converted into SubRip, both in UTF-8.
+	// It's also available in WebVTT by replacing the extension with .vtt.
+	URL    *url.URL
+	SRTURL *url.URL
+
+	// name is the file name without the extension.
+	name string
+	path string
+}
+
+// ProtocolInfo returns the protocol info of the subtitle as a resource.
+func (s Subtitle) ProtocolInfo() string {
+	return "http-get:*:" + s.MIME + ":*"
+}
+
+// sidecars returns the subtitle files among the paths by their directories.
+// It must be called with m.mu locked.
+func (m *MediaLibrary) sidecars(paths []string) map[string][]Subtitle {
+	subs := map[string][]Subtitle{}
+	for _, p := range paths {
+		ext := strings.ToLower(filepath.Ext(p))
+		t, ok := subtitleTypes[ext]
+		if !ok || m.entries[p].Dir {
+			continue
+		}
+		r, ok := m.root(p)
+		if !ok {
+			continue
+		}
+		rel, _ := r.rel(p)
+		id := r.id(rel)
+		dir := filepath.Dir(p)
+		subs[dir] = append(subs[dir], Subtitle{
+			ID:     id,
+			Type:   ext[1:],
+			MIME:   t,
+			URL:    m.BaseURL.ResolveReference(&url.URL{Path: id + ext}),
+			SRTURL: m.BaseURL.ResolveReference(&url.URL{Path: id + ".srt"}),
+			name:   strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)),
+			path:   p,
+		})
+	}
+	return subs
+}
+
+// matchSubtitles returns the subtitles for the video named name, i.e. name.ext or name.lang.ext, in SubRip first order.
+func matchSubtitles(subs []Subtitle, name string) []Subtitle {
+	name = strings.TrimSuffix(name, path.Ext(name))
+
+	var matched []Subtitle
+	for _, s := range subs {
+		switch {
+		case s.name == name:
+		case strings.HasPrefix(s.name, name+".") && !strings.Contains(s.name[len(name)+1:], "."):
+			s.Language = s.name[len(name)+1:]
+		default:
+			continue
+		}
+		matched = append(matched, s)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Type == "srt" && matched[j].Type != "srt"
+	})
+	return matched
+}
+
+// subtitleLimit is the maximum size of a subtitle file.
+const subtitleLimit = 16 << 20
+
+// serveSubtitle serves the subtitle s in UTF-8 in the format of ext, which is either its own extension, .srt or .vtt.
+func serveSubtitle(w http.ResponseWriter, r *http.Request, s *Subtitle, ext string) {
+	if ext != "."+s.Type && ext != ".srt" && ext != ".vtt" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		log.WithField("path", s.path).WithError(err).Warn("Failed to open.")
+		http.NotFound(w, r)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	b, err := io.ReadAll(io.LimitReader(f, subtitleLimit))
+	if err != nil {
+		log.WithField("path", s.path).WithError(err).Warn("Failed to read.")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	text, err := decodeText(b)
+	if err != nil {
+		log.WithField("path", s.path).WithError(err).Warn("Failed to decode.")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	mime := s.MIME
+	b = []byte(text)
+	if ext != "."+s.Type {
+		cues, err := parseCaptions(s.Type, text)
+		if err != nil {
+			log.WithField("path", s.path).WithError(err).Warn("Failed to parse.")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		mime = subtitleTypes[ext]
+		if ext == ".srt" {
+			b = writeSRT(cues)
+		} else {
+			b = writeVTT(cues)
+		}
+	}
+
+	w.Header().Set("Content-Type", mime+"; charset=utf-8")
+	http.ServeContent(w, r, path.Base(r.URL.Path), fi.ModTime(), bytes.NewReader(b))
+}
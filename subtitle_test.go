@@ -0,0 +1,90 @@
+package cast
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestMatchSubtitles(t *testing.T) {
+	subs := []Subtitle{
+		{ID: "1", Type: "ass", name: "movie.ja"},
+		{ID: "2", Type: "srt", name: "movie"},
+		{ID: "3", Type: "srt", name: "movie.en"},
+		{ID: "4", Type: "srt", name: "movie.director.en"},
+		{ID: "5", Type: "srt", name: "movie2"},
+		{ID: "6", Type: "vtt", name: "movie"},
+	}
+	got := matchSubtitles(subs, "movie.mkv")
+	want := []struct {
+		id, lang string
+	}{
+		{id: "2"},
+		{id: "3", lang: "en"},
+		{id: "1", lang: "ja"},
+		{id: "6"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i, w := range want {
+		if got[i].ID != w.id || got[i].Language != w.lang {
+			t.Errorf("got %s %q, want %s %q", got[i].ID, got[i].Language, w.id, w.lang)
+		}
+	}
+}
+
+func TestServeSubtitle(t *testing.T) {
+	srt, err := japanese.ShiftJIS.NewEncoder().String("1\r\n00:00:01,000 --> 00:00:02,000\r\nこんにちは、世界 & <i>皆さん</i>\r\n\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "movie.ja.srt")
+	if err := os.WriteFile(path, []byte(srt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := Subtitle{ID: "1", Type: "srt", MIME: "text/srt", path: path}
+
+	tests := []struct {
+		ext         string
+		code        int
+		contentType string
+		body        string
+	}{
+		{
+			ext:         ".srt",
+			code:        http.StatusOK,
+			contentType: "text/srt; charset=utf-8",
+			body:        "1\r\n00:00:01,000 --> 00:00:02,000\r\nこんにちは、世界 & <i>皆さん</i>\r\n\r\n",
+		},
+		{
+			ext:         ".vtt",
+			code:        http.StatusOK,
+			contentType: "text/vtt; charset=utf-8",
+			body:        "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nこんにちは、世界 &amp; <i>皆さん</i>\n\n",
+		},
+		{ext: ".ass", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			serveSubtitle(w, httptest.NewRequest(http.MethodGet, "/1"+tt.ext, nil), &s, tt.ext)
+			if w.Code != tt.code {
+				t.Fatalf("got %d, want %d", w.Code, tt.code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("got %s, want %s", got, tt.contentType)
+			}
+			if got := w.Body.String(); got != tt.body {
+				t.Errorf("got %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package cast
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // for image.Decode
+	"image/jpeg"
+	_ "image/png" // for image.Decode
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// imageProfiles are the DLNA media format profiles of the resized copies of images with their maximum sizes, smallest first.
+var imageProfiles = []struct {
+	name          string
+	width, height int
+}{
+	{name: "JPEG_TN", width: 160, height: 160},
+	{name: "JPEG_SM", width: 640, height: 480},
+	{name: "JPEG_LRG", width: 4096, height: 4096},
+}
+
+// resizable are the MIME types of the images which can be resized.
+var resizable = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// parseImage reads the dimensions of PNG and GIF images.
+func parseImage(r io.ReaderAt, size int64, md *metadata) error {
+	c, _, err := image.DecodeConfig(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	md.Width, md.Height = c.Width, c.Height
+	return nil
+}
+
+// variants returns the resized copies of the image i in the DLNA profiles which are worth offering.
+// A copy in a profile is offered only if the image doesn't fit in the next smaller profile.
+// Nothing is returned if m.ArtURL is nil or the image can't be resized.
+func (m *MediaLibrary) variants(i MediaItem, e *entry) []*Art {
+	w, h := e.Meta.Width, e.Meta.Height
+	if m.ArtURL == nil || !resizable[e.MIME] || w <= 0 || h <= 0 {
+		return nil
+	}
+	// Images are turned upright as they're resized.
+	if e.Meta.Orientation >= 5 {
+		w, h = h, w
+	}
+
+	var vs []*Art
+	for n, p := range imageProfiles {
+		if n > 0 && w <= imageProfiles[n-1].width && h <= imageProfiles[n-1].height {
+			break
+		}
+		id := objectID(i.ID, p.name)
+		fw, fh := fit(w, h, p.width, p.height)
+		vs = append(vs, &Art{
+			ID:          id,
+			MIME:        "image/jpeg",
+			URL:         m.ArtURL.ResolveReference(&url.URL{Path: id + ".jpg"}),
+			Width:       fw,
+			Height:      fh,
+			path:        i.path,
+			profile:     p.name,
+			orientation: e.Meta.Orientation,
+		})
+	}
+	return vs
+}
+
+// fit returns the size of a w x h image scaled down to fit in maxWidth x maxHeight keeping its aspect ratio.
+func fit(w, h, maxWidth, maxHeight int) (int, int) {
+	if w <= maxWidth && h <= maxHeight {
+		return w, h
+	}
+	if w*maxHeight > h*maxWidth {
+		return maxWidth, max1(h * maxWidth / w)
+	}
+	return max1(w * maxHeight / h), maxHeight
+}
+
+func max1(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// thumbnailSlots limits the number of images resized at once since a large image takes hundreds of megabytes in memory.
+var thumbnailSlots = make(chan struct{}, runtime.NumCPU())
+
+// thumbnailQuality is the JPEG quality of resized images.
+const thumbnailQuality = 85
+
+// serveThumbnail serves the resized copy of the image a read from src, which is cached in m.ThumbnailDir if it's set.
+func (m *MediaLibrary) serveThumbnail(w http.ResponseWriter, r *http.Request, a *Art, src io.Reader, name string, modTime time.Time) {
+	var cache string
+	if m.ThumbnailDir != "" {
+		cache = filepath.Join(m.ThumbnailDir, thumbnailCache(a, modTime))
+	}
+
+	var b []byte
+	if cache != "" {
+		b, _ = os.ReadFile(cache)
+	}
+	if b == nil {
+		var err error
+		thumbnailSlots <- struct{}{}
+		b, err = resize(src, a.Width, a.Height, a.orientation)
+		<-thumbnailSlots
+		if err != nil {
+			log.WithField("path", a.path).WithError(err).Warn("Failed to resize.")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if cache != "" {
+			if err := writeFile(cache, b); err != nil {
+				log.WithField("path", cache).WithError(err).Warn("Failed to cache thumbnail.")
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", a.MIME)
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(b))
+}
+
+// thumbnailCache returns the file name of the cached resized copy of the image a modified at modTime.
+func thumbnailCache(a *Art, modTime time.Time) string {
+	return objectID(a.path, modTime.UTC().Format(time.RFC3339Nano), a.profile) + ".jpg"
+}
+
+// pruneThumbnails removes the cached resized copies in dir other than keep, which are of the images removed or modified since.
+// Files which aren't named by thumbnailCache are left alone.
+func pruneThumbnails(dir string, keep map[string]struct{}) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.WithField("dir", dir).WithError(err).Warn("Failed to read thumbnails.")
+		}
+		return
+	}
+	for _, f := range files {
+		name := f.Name()
+		if _, ok := keep[name]; ok || !isThumbnailCache(name) || !f.Type().IsRegular() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.WithField("path", filepath.Join(dir, name)).WithError(err).Warn("Failed to remove thumbnail.")
+		}
+	}
+}
+
+// isThumbnailCache tells if the file name is of the form of thumbnailCache.
+func isThumbnailCache(name string) bool {
+	id := strings.TrimSuffix(name, ".jpg")
+	if len(id) != 16 || id == name {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// resize returns the JPEG of the image read from r scaled to width x height after turning it upright by the EXIF orientation.
+func resize(r io.Reader, width, height, orientation int) ([]byte, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scale before rotating so that the larger image isn't rotated.
+	w, h := width, height
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, orient(dst, orientation), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// orient turns the image upright by the EXIF orientation, which tells how it's flipped and rotated.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
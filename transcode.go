@@ -0,0 +1,190 @@
+package cast
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TranscodeProfile is a way to transcode media files into a format TVs can play with an ffmpeg-compatible encoder.
+type TranscodeProfile struct {
+	// Name identifies the profile, e.g. h264.
+	Name string
+	// Class is the class of the items which are transcoded, e.g. object.item.videoItem. Items of its subclasses are also transcoded.
+	Class string
+	// MIME is the MIME type of the output, e.g. video/mp2t.
+	MIME string
+	// Ext is the extension of the output in the URL, e.g. .ts.
+	Ext string
+	// DLNAProfile is the DLNA media format profile of the output, if any.
+	DLNAProfile string
+	// Args are the arguments to the encoder, in which {input} is replaced with the path of the media file.
+	// The encoder must write the output to its standard output.
+	Args []string
+}
+
+// DefaultTranscodeProfiles transcode videos into MPEG-TS with H.264 and AAC, and audio into MP3, with ffmpeg.
+var DefaultTranscodeProfiles = []TranscodeProfile{
+	{
+		Name:        "h264",
+		Class:       MediaClassVideoItem.String(),
+		MIME:        "video/mp2t",
+		Ext:         ".ts",
+		DLNAProfile: "AVC_TS_MP_HD_AAC_MULT5_ISO",
+		Args: []string{
+			"-hide_banner", "-loglevel", "error", "-nostdin",
+			"-i", "{input}",
+			"-map", "0:v:0", "-map", "0:a:0?",
+			"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main", "-level", "4.0", "-pix_fmt", "yuv420p",
+			"-vf", "scale=w='min(1920,iw)':h='min(1080,ih)':force_original_aspect_ratio=decrease:force_divisible_by=2",
+			"-c:a", "aac", "-ac", "2", "-b:a", "192k",
+			"-f", "mpegts", "pipe:1",
+		},
+	},
+	{
+		Name:        "mp3",
+		Class:       MediaClassAudioItem.String(),
+		MIME:        "audio/mpeg",
+		Ext:         ".mp3",
+		DLNAProfile: "MP3",
+		Args: []string{
+			"-hide_banner", "-loglevel", "error", "-nostdin",
+			"-i", "{input}",
+			"-vn", "-c:a", "libmp3lame", "-b:a", "320k",
+			"-f", "mp3", "pipe:1",
+		},
+	},
+}
+
+// Transcode is a copy of a media item transcoded on the fly by a profile.
+type Transcode struct {
+	ID           string
+	URL          *url.URL
+	ProtocolInfo string
+	Duration     Duration
+
+	path    string
+	profile *TranscodeProfile
+}
+
+// transcoded returns the transcoded copies of the item i by the profiles for its class except those in its own format.
+// Nothing is returned if m.Transcoder is empty.
+func (m *MediaLibrary) transcoded(i MediaItem, e *entry) []*Transcode {
+	if m.Transcoder == "" {
+		return nil
+	}
+	var ts []*Transcode
+	for n := range m.TranscodeProfiles {
+		p := &m.TranscodeProfiles[n]
+		if !i.Class.DerivedFrom(p.Class) || e.MIME == p.MIME {
+			continue
+		}
+		id := objectID(i.ID, p.Name)
+		ts = append(ts, &Transcode{
+			ID:  id,
+			URL: m.BaseURL.ResolveReference(&url.URL{Path: id + p.Ext}),
+			// Neither byte ranges nor times are supported in the output being encoded.
+			ProtocolInfo: protocolInfo(p.MIME, p.DLNAProfile, true, 0),
+			Duration:     i.Duration,
+			path:         i.path,
+			profile:      p,
+		})
+	}
+	return ts
+}
+
+// transcodeSlots returns the semaphore which limits the number of the encoders running at once to m.MaxTranscodes.
+func (m *MediaLibrary) transcodeSlots() chan struct{} {
+	m.transcodingOnce.Do(func() {
+		n := m.MaxTranscodes
+		if n <= 0 {
+			n = 1
+		}
+		m.transcoding = make(chan struct{}, n)
+	})
+	return m.transcoding
+}
+
+// serveTranscode streams the output of the encoder transcoding the media file of t.
+// The encoder is killed as soon as the client goes away. If too many encoders are running, it responds with 503.
+func (m *MediaLibrary) serveTranscode(w http.ResponseWriter, r *http.Request, t *Transcode) {
+	if !dlnaHeaders(w, r, t.ProtocolInfo) {
+		return
+	}
+	if r.Header.Get("TimeSeekRange.dlna.org") != "" {
+		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return
+	}
+	w.Header().Set("Content-Type", t.profile.MIME)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	slots := m.transcodeSlots()
+	select {
+	case slots <- struct{}{}:
+		defer func() {
+			<-slots
+		}()
+	default:
+		log.WithField("path", t.path).Warn("Too many transcodes.")
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	args := make([]string, len(t.profile.Args))
+	for n, a := range t.profile.Args {
+		args[n] = strings.ReplaceAll(a, "{input}", t.path)
+	}
+	cmd := exec.CommandContext(ctx, m.Transcoder, args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		log.WithField("path", t.path).WithError(err).Warn("Failed to transcode.")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		log.WithField("path", t.path).WithError(err).Warn("Failed to transcode.")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	l := log.WithFields(log.Fields{
+		"path":    t.path,
+		"profile": t.profile.Name,
+	})
+	l.Info("Start transcoding.")
+	if _, err := io.Copy(flushWriter{w: w}, out); err != nil {
+		// The client went away.
+		cancel()
+	}
+	switch err := cmd.Wait(); {
+	case r.Context().Err() != nil || ctx.Err() != nil:
+		l.Info("Stop transcoding.")
+	case err != nil:
+		l.WithError(err).Warn("Failed to transcode.")
+	default:
+		l.Info("Finish transcoding.")
+	}
+}
+
+// flushWriter flushes every write so that the client receives the output as soon as the encoder writes it.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	return n, err
+}
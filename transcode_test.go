@@ -0,0 +1,150 @@
+package cast
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestEncoder isn't a test but the fake encoder which the tests run as a subprocess with CAST_TEST_ENCODER set.
+// It writes the input to the standard output and then hangs if CAST_TEST_ENCODER is hang.
+func TestEncoder(t *testing.T) {
+	mode := os.Getenv("CAST_TEST_ENCODER")
+	if mode == "" {
+		return
+	}
+	b, err := os.ReadFile(os.Args[len(os.Args)-1])
+	if err != nil {
+		os.Exit(1)
+	}
+	_, _ = os.Stdout.Write(b)
+	if mode == "hang" {
+		time.Sleep(time.Hour)
+	}
+	os.Exit(0)
+}
+
+// fakeTranscode returns the library which runs the fake encoder in the mode and the transcode of a file with the content.
+func fakeTranscode(t *testing.T, mode string, content []byte) (*MediaLibrary, *Transcode) {
+	t.Setenv("CAST_TEST_ENCODER", mode)
+	path := filepath.Join(t.TempDir(), "a.mkv")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := MediaLibrary{
+		Transcoder: os.Args[0],
+		TranscodeProfiles: []TranscodeProfile{
+			{Name: "fake", Class: MediaClassVideoItem.String(), MIME: "video/mp2t", Ext: ".ts", Args: []string{"-test.run=^TestEncoder$", "--", "{input}"}},
+		},
+		MaxTranscodes: 1,
+	}
+	p := &m.TranscodeProfiles[0]
+	return &m, &Transcode{
+		ID:           "1",
+		ProtocolInfo: protocolInfo(p.MIME, p.DLNAProfile, true, 0),
+		path:         path,
+		profile:      p,
+	}
+}
+
+func TestMediaLibrary_ServeTranscode(t *testing.T) {
+	content := bytes.Repeat([]byte("transcoded"), 10000)
+	m, tc := fakeTranscode(t, "cat", content)
+
+	w := httptest.NewRecorder()
+	m.serveTranscode(w, httptest.NewRequest(http.MethodGet, "/1.fake.ts", nil), tc)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "video/mp2t" {
+		t.Errorf("got Content-Type %s", got)
+	}
+	if got := w.Header()["transferMode.dlna.org"]; len(got) != 1 || got[0] != "Streaming" {
+		t.Errorf("got transferMode.dlna.org %q", got)
+	}
+	if !bytes.Equal(w.Body.Bytes(), content) {
+		t.Errorf("got %d bytes, want %d", w.Body.Len(), len(content))
+	}
+	if n := len(m.transcodeSlots()); n != 0 {
+		t.Errorf("%d slots left taken", n)
+	}
+}
+
+func TestMediaLibrary_ServeTranscode_Busy(t *testing.T) {
+	m, tc := fakeTranscode(t, "cat", []byte("transcoded"))
+
+	// Another file is being transcoded.
+	slots := m.transcodeSlots()
+	slots <- struct{}{}
+	defer func() {
+		<-slots
+	}()
+
+	w := httptest.NewRecorder()
+	m.serveTranscode(w, httptest.NewRequest(http.MethodGet, "/1.fake.ts", nil), tc)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestMediaLibrary_ServeTranscode_Seek(t *testing.T) {
+	m, tc := fakeTranscode(t, "cat", []byte("transcoded"))
+
+	r := httptest.NewRequest(http.MethodGet, "/1.fake.ts", nil)
+	r.Header.Set("TimeSeekRange.dlna.org", "npt=10-")
+	w := httptest.NewRecorder()
+	m.serveTranscode(w, r, tc)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("got %d, want %d", w.Code, http.StatusNotAcceptable)
+	}
+}
+
+func TestMediaLibrary_ServeTranscode_Disconnect(t *testing.T) {
+	content := []byte("transcoded")
+	m, tc := fakeTranscode(t, "hang", content)
+
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		m.serveTranscode(w, r, tc)
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	b := make([]byte, len(content))
+	if _, err := io.ReadFull(resp.Body, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Error("got different content")
+	}
+
+	// The encoder hangs until it's killed as the client goes away.
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the encoder wasn't killed")
+	}
+	if n := len(m.transcodeSlots()); n != 0 {
+		t.Errorf("%d slots left taken", n)
+	}
+}
@@ -0,0 +1,181 @@
+package cast
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// FLAC metadata block types.
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockVorbisComment = 4
+	flacBlockPicture       = 6
+)
+
+// parseFLAC reads the stream properties and the Vorbis comments of a FLAC file.
+func parseFLAC(r io.ReaderAt, size int64, md *metadata) error {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return err
+	}
+	if string(magic[:]) != "fLaC" {
+		return errMalformed
+	}
+
+	for offset := int64(4); offset+4 <= size; {
+		var h [4]byte
+		if _, err := r.ReadAt(h[:], offset); err != nil {
+			return err
+		}
+		var (
+			last = h[0]&0x80 != 0
+			typ  = h[0] & 0x7f
+			n    = int64(h[1])<<16 | int64(h[2])<<8 | int64(h[3])
+		)
+		offset += 4
+		if offset+n > size {
+			return errMalformed
+		}
+
+		switch typ {
+		case flacBlockStreamInfo:
+			b := make([]byte, n)
+			if _, err := r.ReadAt(b, offset); err != nil {
+				return err
+			}
+			if len(b) >= 18 {
+				rate := int(b[10])<<12 | int(b[11])<<4 | int(b[12])>>4
+				samples := uint64(b[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(b[14:]))
+				md.SampleRate = rate
+				md.Channels = int(b[12]>>1&0x07) + 1
+				if rate > 0 {
+					md.Duration = time.Duration(samples) * time.Second / time.Duration(rate)
+				}
+			}
+		case flacBlockVorbisComment:
+			b := make([]byte, n)
+			if _, err := r.ReadAt(b, offset); err != nil {
+				return err
+			}
+			parseVorbisComment(b, md)
+		case flacBlockPicture:
+			if err := parseFLACPicture(r, offset, n, md); err != nil {
+				return err
+			}
+		}
+
+		if last {
+			break
+		}
+		offset += n
+	}
+	return nil
+}
+
+// parseFLACPicture locates the image in the picture block of n bytes at offset.
+func parseFLACPicture(r io.ReaderAt, offset, n int64, md *metadata) error {
+	// The picture type and the lengths of the MIME type and the description, each followed by its value.
+	var (
+		h   [4]byte
+		pos = offset
+		typ uint32
+	)
+	for i := 0; i < 3; i++ {
+		if pos+4 > offset+n {
+			return errMalformed
+		}
+		if _, err := r.ReadAt(h[:], pos); err != nil {
+			return err
+		}
+		v := binary.BigEndian.Uint32(h[:])
+		pos += 4
+		if i == 0 {
+			typ = v
+			continue
+		}
+		pos += int64(v)
+	}
+	// Width, height, color depth, the number of colors and the length of the image data.
+	var d [20]byte
+	if pos+20 > offset+n {
+		return errMalformed
+	}
+	if _, err := r.ReadAt(d[:], pos); err != nil {
+		return err
+	}
+	pos += 20
+	size := int64(binary.BigEndian.Uint32(d[16:]))
+	if pos+size > offset+n {
+		return errMalformed
+	}
+
+	if !md.Picture.prefer(typ) {
+		return nil
+	}
+	var magic [8]byte
+	if _, err := r.ReadAt(magic[:], pos); err != nil {
+		return err
+	}
+	if t := imageType(magic[:]); t != "" {
+		md.Picture = picture{Offset: pos, Size: size, MIME: t, Front: typ == frontCover}
+	}
+	return nil
+}
+
+// parseVorbisComment reads the tags from a Vorbis comment, which is used by FLAC, Ogg Vorbis and Opus.
+func parseVorbisComment(b []byte, md *metadata) {
+	next := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+
+	if _, ok := next(); !ok {
+		return
+	}
+	if len(b) < 4 {
+		return
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for i := uint32(0); i < count; i++ {
+		c, ok := next()
+		if !ok {
+			return
+		}
+		j := strings.Index(c, "=")
+		if j < 0 {
+			continue
+		}
+		key, value := strings.ToUpper(c[:j]), strings.TrimSpace(c[j+1:])
+		switch key {
+		case "TITLE":
+			md.Title = value
+		case "ARTIST":
+			if md.Artist == "" {
+				md.Artist = value
+			}
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			md.AlbumArtist = value
+		case "ALBUM":
+			md.Album = value
+		case "GENRE":
+			if md.Genre == "" {
+				md.Genre = value
+			}
+		case "TRACKNUMBER":
+			md.Track = trackNumber(value)
+		case "DATE":
+			md.Date = normalizeDate(value)
+		}
+	}
+}
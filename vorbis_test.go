@@ -0,0 +1,127 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+)
+
+// vorbisComment returns a Vorbis comment with the comments.
+func vorbisComment(comments ...string) []byte {
+	var b bytes.Buffer
+	str := func(s string) {
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(s)))
+		b.WriteString(s)
+	}
+	str("vendor")
+	_ = binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		str(c)
+	}
+	return b.Bytes()
+}
+
+func TestParseFLAC(t *testing.T) {
+	b, err := os.ReadFile("testdata/tags.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var md metadata
+	if err := parseFLAC(bytes.NewReader(b), int64(len(b)), &md); err != nil {
+		t.Fatal(err)
+	}
+	want := metadata{
+		Duration:    10 * time.Second,
+		Channels:    2,
+		SampleRate:  44100,
+		Title:       "Title",
+		Artist:      "Artist",
+		AlbumArtist: "Album Artist",
+		Album:       "Album",
+		Genre:       "Rock",
+		Track:       3,
+		Date:        "2004-05-01",
+	}
+	if md.Duration != want.Duration || md.Channels != want.Channels || md.SampleRate != want.SampleRate ||
+		md.Title != want.Title || md.Artist != want.Artist || md.AlbumArtist != want.AlbumArtist ||
+		md.Album != want.Album || md.Genre != want.Genre || md.Track != want.Track || md.Date != want.Date {
+		t.Errorf("got %+v, want %+v", md, want)
+	}
+	if want := (picture{Offset: 278, Size: 73, MIME: "image/png", Front: true}); md.Picture != want {
+		t.Errorf("got %+v, want %+v", md.Picture, want)
+	}
+}
+
+func TestParseFLAC_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not FLAC", data: []byte("OggS\x00\x02")},
+		{name: "block larger than file", data: []byte("fLaC\x80\x00\x00\x22\x00")},
+		{name: "short picture", data: []byte("fLaC\x86\x00\x00\x04\x00\x00\x00\x03")},
+		{name: "picture MIME type larger than block", data: []byte("fLaC\x86\x00\x00\x08\x00\x00\x00\x03\x00\x00\x01\x00")},
+		{name: "picture data larger than block", data: append([]byte("fLaC\x86\x00\x00\x20\x00\x00\x00\x03"), append(make([]byte, 27), 1)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			if err := parseFLAC(bytes.NewReader(tt.data), int64(len(tt.data)), &md); err != errMalformed {
+				t.Errorf("got %v, want %v", err, errMalformed)
+			}
+		})
+	}
+}
+
+func TestParseVorbisComment(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want metadata
+	}{
+		{
+			name: "keys in any case",
+			data: vorbisComment("title=Title", "Album=Album", "TrackNumber=3/12", "date=2004-05-06"),
+			want: metadata{Title: "Title", Album: "Album", Track: 3, Date: "2004-05-06"},
+		},
+		{
+			name: "first of multiple artists and genres",
+			data: vorbisComment("ARTIST=Artist", "ARTIST=Other", "GENRE=Rock", "GENRE=Pop"),
+			want: metadata{Artist: "Artist", Genre: "Rock"},
+		},
+		{
+			name: "album artist with a space",
+			data: vorbisComment("ALBUM ARTIST=Album Artist"),
+			want: metadata{AlbumArtist: "Album Artist"},
+		},
+		{
+			name: "without value",
+			data: vorbisComment("TITLE", "ALBUM= Album "),
+			want: metadata{Album: "Album"},
+		},
+		{
+			name: "more comments than there are",
+			data: vorbisComment("TITLE=Title")[:len(vorbisComment("TITLE=Title"))-2],
+		},
+		{
+			name: "truncated count",
+			data: vorbisComment()[:12],
+		},
+		{
+			name: "vendor longer than comment",
+			data: []byte{0xff, 0xff, 0xff, 0xff, 'v'},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			parseVorbisComment(tt.data, &md)
+			if md.Title != tt.want.Title || md.Artist != tt.want.Artist || md.AlbumArtist != tt.want.AlbumArtist ||
+				md.Album != tt.want.Album || md.Genre != tt.want.Genre || md.Track != tt.want.Track || md.Date != tt.want.Date {
+				t.Errorf("got %+v, want %+v", md, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package cast
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// linkDirEntry is a directory reached through a symlink.
+type linkDirEntry struct {
+	fs.DirEntry
+	target fileID
+}
+
+// walk walks the file tree at p like filepath.WalkDir.
+// If m.FollowSymlinks is set, it also walks into symlinked directories and reports them as *linkDirEntry.
+// Symlinks which lead to their own ancestors are never followed.
+// Unless m.Duplicates is set, symlinks to directories in the roots or to the targets in seen aren't followed either.
+func (m *MediaLibrary) walk(p string, seen map[fileID]string, fn fs.WalkDirFunc) error {
+	fi, err := os.Lstat(p)
+	if err != nil {
+		err = fn(p, nil, err)
+	} else {
+		err = m.walkDir(p, fs.FileInfoToDirEntry(fi), seen, map[fileID]struct{}{}, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (m *MediaLibrary) walkDir(p string, d fs.DirEntry, seen map[fileID]string, ancestors map[fileID]struct{}, fn fs.WalkDirFunc) error {
+	link := d.Type()&fs.ModeSymlink != 0
+	if link {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return fn(p, d, err)
+		}
+		if fi.IsDir() && !m.FollowSymlinks {
+			log.WithField("path", p).Debug("Skip symlink.")
+			return nil
+		}
+		d = fs.FileInfoToDirEntry(fi)
+	}
+
+	if !d.IsDir() {
+		return fn(p, d, nil)
+	}
+
+	fi, err := d.Info()
+	if err != nil {
+		return fn(p, d, err)
+	}
+	id, ok := identify(p, fi)
+	if ok {
+		if _, ok := ancestors[id]; ok {
+			log.WithField("path", p).Warn("Skip symlink cycle.")
+			return nil
+		}
+		if link && !m.Duplicates {
+			if q, ok := seen[id]; ok {
+				log.WithFields(log.Fields{"path": p, "duplicate": q}).Info("Skip duplicate symlink.")
+				return nil
+			}
+			if target, err := filepath.EvalSymlinks(p); err == nil {
+				if _, ok := m.root(target); ok {
+					log.WithFields(log.Fields{"path": p, "duplicate": target}).Info("Skip duplicate symlink.")
+					return nil
+				}
+			}
+		}
+	}
+	if link {
+		d = &linkDirEntry{DirEntry: d, target: id}
+	}
+
+	if err := fn(p, d, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	if ok {
+		if link {
+			seen[id] = p
+		}
+		ancestors[id] = struct{}{}
+		defer delete(ancestors, id)
+	}
+
+	es, err := os.ReadDir(p)
+	if err != nil {
+		if err := fn(p, d, err); err != nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+
+	for _, e := range es {
+		if err := m.walkDir(filepath.Join(p, e.Name()), e, seen, ancestors, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package cast
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMediaLibrary_Walk_Symlinks(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"lib/a/1.txt", "lib2/b/2.txt", "outside/3.txt"} {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("text"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		// A link back to an ancestor.
+		"lib/a/loop": "..",
+		// Two links to the same directory outside of the roots.
+		"lib/x1": "../outside",
+		"lib/x2": "../outside",
+		// A link into another root.
+		"lib/other": "../lib2/b",
+	} {
+		if err := os.Symlink(filepath.FromSlash(target), filepath.Join(dir, filepath.FromSlash(link))); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		followSymlinks bool
+		duplicates     bool
+		want           []string
+	}{
+		{
+			name: "symlinks not followed",
+			want: []string{"lib", "lib/a", "lib/a/1.txt", "lib2", "lib2/b", "lib2/b/2.txt"},
+		},
+		{
+			name: "duplicate symlinks not followed",
+			// x2 leads to the directory already reached through x1 and other to the one in lib2.
+			followSymlinks: true,
+			want:           []string{"lib", "lib/a", "lib/a/1.txt", "lib/x1", "lib/x1/3.txt", "lib2", "lib2/b", "lib2/b/2.txt"},
+		},
+		{
+			name: "duplicate symlinks followed",
+			// Links to ancestors are never followed.
+			followSymlinks: true,
+			duplicates:     true,
+			want: []string{
+				"lib", "lib/a", "lib/a/1.txt", "lib/other", "lib/other/2.txt", "lib/x1", "lib/x1/3.txt", "lib/x2", "lib/x2/3.txt",
+				"lib2", "lib2/b", "lib2/b/2.txt",
+			},
+		},
+		{
+			name:       "duplicates without following symlinks",
+			duplicates: true,
+			want:       []string{"lib", "lib/a", "lib/a/1.txt", "lib2", "lib2/b", "lib2/b/2.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := MediaLibrary{
+				BaseURL:        &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"},
+				Roots:          []Root{{Path: filepath.Join(dir, "lib")}, {Path: filepath.Join(dir, "lib2")}},
+				AllFiles:       true,
+				FollowSymlinks: tt.followSymlinks,
+				Duplicates:     tt.duplicates,
+			}
+			if err := m.Scan(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for p, e := range m.entries {
+				rel, err := filepath.Rel(dir, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+				// Directories reached through symlinks remember their targets.
+				if _, err := os.Readlink(p); (err == nil) != (e.link != nil) {
+					t.Errorf("%s: got link %v", rel, e.link)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package cast
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchDelay is how long Watch waits for further changes before applying them so that a burst of changes,
+// e.g. copying a directory, results in a single update. Every change restarts the wait.
+var watchDelay = time.Second
+
+// Watch watches the library directory and updates the content tree as files are added, removed or renamed.
+// It blocks until ctx is done.
+func (m *MediaLibrary) Watch(ctx context.Context) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.WithError(err).Error("fsnotify.NewWatcher() failed.")
+		return
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			log.WithError(err).Error("Failed to close.")
+		}
+	}()
+
+	m.mu.RLock()
+	for path, e := range m.entries {
+		if e.Dir {
+			watch(w, path)
+		}
+	}
+	m.mu.RUnlock()
+
+	pending := map[string]struct{}{}
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			log.WithFields(log.Fields{
+				"path": ev.Name,
+				"op":   ev.Op,
+			}).Debug("watch")
+			pending[ev.Name] = struct{}{}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(watchDelay)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.WithError(err).Warn("Failed to watch.")
+		case <-timer.C:
+			m.update(w, pending)
+			pending = map[string]struct{}{}
+		}
+	}
+}
+
+// update rescans the changed paths and applies the result to the content tree.
+// The system update ID is incremented only if any entries have actually changed.
+func (m *MediaLibrary) update(w *fsnotify.Watcher, paths map[string]struct{}) {
+	m.mu.RLock()
+	changes := make(map[string]map[string]*entry, len(paths))
+	for path := range paths {
+		if filepath.Base(path) == ignoreFile {
+			path = filepath.Dir(path)
+		}
+		r, ok := m.root(path)
+		if !ok {
+			continue
+		}
+
+		_, err := os.Stat(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			changes[path] = nil
+		case err != nil:
+			log.WithField("path", path).WithError(err).Warn("Failed to stat.")
+		default:
+			entries, err := m.scan(r, path, m.entries, func(path string) {
+				watch(w, path)
+			})
+			if err != nil {
+				log.WithField("path", path).WithError(err).Warn("Failed to scan.")
+				continue
+			}
+			changes[path] = entries
+		}
+	}
+	m.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := make([]string, 0, len(changes))
+	for path := range changes {
+		changed = append(changed, path)
+	}
+	sort.Strings(changed)
+
+	var modified bool
+	for _, path := range changed {
+		entries := changes[path]
+		if _, ok := m.entries[filepath.Dir(path)]; !ok && !m.isRoot(path) {
+			continue
+		}
+		var n int
+		for p, e := range m.entries {
+			if p == path || strings.HasPrefix(p, path+string(filepath.Separator)) {
+				if f, ok := entries[p]; !ok || !f.same(e) {
+					modified = true
+				}
+				n++
+				delete(m.entries, p)
+			}
+		}
+		if n != len(entries) {
+			modified = true
+		}
+		for p, e := range entries {
+			m.entries[p] = e
+		}
+	}
+	if !modified {
+		log.Debug("No changes in media library.")
+		return
+	}
+
+	m.systemUpdateID++
+	m.rebuild()
+	m.saveIndex()
+
+	log.WithField("systemUpdateID", m.systemUpdateID).Info("Updated media library.")
+}
+
+func watch(w *fsnotify.Watcher, path string) {
+	if err := w.Add(path); err != nil {
+		log.WithField("path", path).WithError(err).Warn("Failed to watch.")
+	}
+}
@@ -0,0 +1,150 @@
+package cast
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchedLibrary returns the scanned library of a directory with a file in it.
+func watchedLibrary(t *testing.T) (*MediaLibrary, string) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "1.txt"), []byte("text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := MediaLibrary{BaseURL: &url.URL{Scheme: "http", Host: "192.0.2.1:8200", Path: "/media/"}, Roots: []Root{{Path: dir}}, AllFiles: true}
+	if err := m.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	return &m, m.Roots[0].Path
+}
+
+func TestMediaLibrary_Update(t *testing.T) {
+	m, dir := watchedLibrary(t)
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = w.Close()
+	}()
+
+	tests := []struct {
+		name   string
+		change func() error
+		paths  []string
+		want   int
+	}{
+		{
+			name:   "nothing changed",
+			change: func() error { return nil },
+			paths:  []string{dir, filepath.Join(dir, "1.txt")},
+			want:   0,
+		},
+		{
+			name:   "file added",
+			change: func() error { return os.WriteFile(filepath.Join(dir, "2.txt"), []byte("text"), 0644) },
+			paths:  []string{filepath.Join(dir, "2.txt")},
+			want:   1,
+		},
+		{
+			name: "file modified",
+			change: func() error {
+				return os.Chtimes(filepath.Join(dir, "1.txt"), time.Now(), time.Now().Add(time.Hour))
+			},
+			paths: []string{filepath.Join(dir, "1.txt")},
+			want:  2,
+		},
+		{
+			name:   "file removed",
+			change: func() error { return os.Remove(filepath.Join(dir, "2.txt")) },
+			paths:  []string{filepath.Join(dir, "2.txt")},
+			want:   3,
+		},
+		{
+			name:   "removed file removed again",
+			change: func() error { return nil },
+			paths:  []string{filepath.Join(dir, "2.txt")},
+			want:   3,
+		},
+		{
+			name:   "directory added",
+			change: func() error { return os.Mkdir(filepath.Join(dir, "a"), 0755) },
+			paths:  []string{filepath.Join(dir, "a")},
+			want:   4,
+		},
+		{
+			name:   "directory rescanned",
+			change: func() error { return nil },
+			paths:  []string{dir},
+			want:   4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatal(err)
+			}
+			paths := map[string]struct{}{}
+			for _, p := range tt.paths {
+				paths[p] = struct{}{}
+			}
+			m.update(w, paths)
+			if m.systemUpdateID != tt.want {
+				t.Errorf("got %d, want %d", m.systemUpdateID, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaLibrary_Watch(t *testing.T) {
+	defer func(d time.Duration) {
+		watchDelay = d
+	}(watchDelay)
+	watchDelay = 500 * time.Millisecond
+
+	m, dir := watchedLibrary(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Watch(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	// Wait for the watcher to start.
+	time.Sleep(100 * time.Millisecond)
+
+	// A burst of changes longer than the delay ends up in a single update as every change restarts the wait.
+	const n = 8
+	for i := 0; i < n; i++ {
+		if err := os.WriteFile(filepath.Join(dir, string(rune('a'+i))+".txt"), []byte("text"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(watchDelay / 5)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		m.mu.RLock()
+		id, entries := m.systemUpdateID, len(m.entries)
+		m.mu.RUnlock()
+		if id > 0 {
+			if id != 1 || entries != n+2 {
+				t.Errorf("got update %d with %d entries, want update 1 with %d entries", id, entries, n+2)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("not updated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,73 @@
+package cast
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// WAVE format tags.
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatExtensible = 0xfffe
+)
+
+// parseWAV reads the format and the duration of a WAVE file.
+// The audio codec is lpcm for integer PCM of any bit depth.
+func parseWAV(r io.ReaderAt, size int64, md *metadata) error {
+	var h [12]byte
+	if _, err := r.ReadAt(h[:], 0); err != nil {
+		return err
+	}
+	if string(h[:4]) != "RIFF" || string(h[8:]) != "WAVE" {
+		return errMalformed
+	}
+
+	var byteRate uint32
+	for offset := int64(12); offset+8 <= size; {
+		var c [8]byte
+		if _, err := r.ReadAt(c[:], offset); err != nil {
+			return err
+		}
+		n := int64(binary.LittleEndian.Uint32(c[4:]))
+		offset += 8
+
+		switch string(c[:4]) {
+		case "fmt ":
+			var b [26]byte
+			if n < 16 {
+				return errMalformed
+			}
+			if _, err := r.ReadAt(b[:16], offset); err != nil {
+				return err
+			}
+			format := binary.LittleEndian.Uint16(b[:])
+			// The extensible format has the actual format tag at the head of the subformat GUID.
+			if format == wavFormatExtensible && n >= 26 {
+				if _, err := r.ReadAt(b[16:26], offset+16); err != nil {
+					return err
+				}
+				format = binary.LittleEndian.Uint16(b[24:])
+			}
+			md.Channels = int(binary.LittleEndian.Uint16(b[2:]))
+			md.SampleRate = int(binary.LittleEndian.Uint32(b[4:]))
+			byteRate = binary.LittleEndian.Uint32(b[8:])
+			md.Bitrate = int(byteRate)
+			if format == wavFormatPCM {
+				md.AudioCodec = "lpcm"
+			}
+		case "data":
+			// The size of the data is unknown, i.e. 0 or 0xffffffff, if the file was written as a stream.
+			if n == 0 || offset+n > size {
+				n = size - offset
+			}
+			if byteRate > 0 {
+				md.Duration = time.Duration(float64(n) / float64(byteRate) * float64(time.Second))
+			}
+			return nil
+		}
+		// Chunks are padded to even sizes.
+		offset += n + n&1
+	}
+	return nil
+}
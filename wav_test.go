@@ -0,0 +1,79 @@
+package cast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseWAV(t *testing.T) {
+	b, err := os.ReadFile("testdata/pcm.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// extensible returns a WAVE file with the extensible format whose subformat is the format tag.
+	extensible := func(format uint16, bits uint16) []byte {
+		f := make([]byte, 40)
+		binary.LittleEndian.PutUint16(f, wavFormatExtensible)
+		binary.LittleEndian.PutUint16(f[2:], 2)
+		binary.LittleEndian.PutUint32(f[4:], 48000)
+		binary.LittleEndian.PutUint32(f[8:], 48000*2*uint32(bits)/8)
+		binary.LittleEndian.PutUint16(f[12:], 2*bits/8)
+		binary.LittleEndian.PutUint16(f[14:], bits)
+		binary.LittleEndian.PutUint16(f[16:], 22)
+		binary.LittleEndian.PutUint16(f[24:], format)
+		var w bytes.Buffer
+		w.WriteString("RIFF\x00\x00\x00\x00WAVEfmt ")
+		_ = binary.Write(&w, binary.LittleEndian, uint32(len(f)))
+		w.Write(f)
+		// The size of the data is unknown as if it's written as a stream.
+		w.WriteString("data\xff\xff\xff\xff")
+		w.Write(make([]byte, 48000*2*int(bits)/8))
+		return w.Bytes()
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want metadata
+		err  error
+	}{
+		{
+			name: "pcm.wav",
+			data: b,
+			want: metadata{Duration: 100 * time.Millisecond, Bitrate: 176400, Channels: 2, SampleRate: 44100, AudioCodec: "lpcm"},
+		},
+		{
+			name: "extensible 16-bit",
+			data: extensible(wavFormatPCM, 16),
+			want: metadata{Duration: time.Second, Bitrate: 192000, Channels: 2, SampleRate: 48000, AudioCodec: "lpcm"},
+		},
+		{
+			name: "extensible 24-bit",
+			data: extensible(wavFormatPCM, 24),
+			want: metadata{Duration: time.Second, Bitrate: 288000, Channels: 2, SampleRate: 48000, AudioCodec: "lpcm"},
+		},
+		{
+			name: "extensible float",
+			data: extensible(3, 32),
+			want: metadata{Duration: time.Second, Bitrate: 384000, Channels: 2, SampleRate: 48000},
+		},
+		{name: "not RIFF", data: []byte("RIFX\x00\x00\x00\x00WAVE"), err: errMalformed},
+		{name: "not WAVE", data: []byte("RIFF\x00\x00\x00\x00AVI "), err: errMalformed},
+		{name: "short fmt", data: []byte("RIFF\x00\x00\x00\x00WAVEfmt \x02\x00\x00\x00\x01\x00"), err: errMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var md metadata
+			if err := parseWAV(bytes.NewReader(tt.data), int64(len(tt.data)), &md); err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if md.Duration != tt.want.Duration || md.Bitrate != tt.want.Bitrate || md.Channels != tt.want.Channels ||
+				md.SampleRate != tt.want.SampleRate || md.AudioCodec != tt.want.AudioCodec {
+				t.Errorf("got %+v, want %+v", md, tt.want)
+			}
+		})
+	}
+}